@@ -7,11 +7,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/axywe/distributed-benchmarks/internal/db"
+	api "github.com/axywe/distributed-benchmarks/internal/handlers"
+	"github.com/axywe/distributed-benchmarks/internal/ingest"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
 	"github.com/axywe/distributed-benchmarks/internal/router"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+	"github.com/axywe/distributed-benchmarks/internal/webhooks"
 	"github.com/axywe/distributed-benchmarks/sessions"
 	"github.com/gorilla/handlers"
 	"github.com/joho/godotenv"
@@ -41,7 +47,49 @@ func main() {
 	}
 
 	resultsDir := "results"
-	db.StartCronTask(resultsDir, time.Minute/6)
+	if err := runner.Init(runner.Config{
+		Kind:       os.Getenv("RUNNER"),
+		ResultsDir: resultsDir,
+		DockerHost: os.Getenv("DOCKER_HOST"),
+		Image:      os.Getenv("BENCH_IMAGE"),
+		Python:     os.Getenv("LOCAL_PYTHON"),
+		BenchDir:   os.Getenv("LOCAL_BENCH_DIR"),
+	}); err != nil {
+		log.Fatalf("Ошибка настройки раннера: %v", err)
+	}
+
+	jobs.Default = jobs.NewPool(runner.Default, resultsDir, envInt("JOB_WORKERS"), envInt("JOB_MAX_RUNNING"))
+	jobs.Default.Limits = db.ResourceLimits{
+		CPUs:           envFloat("RUN_CPU_LIMIT"),
+		MemoryMB:       envInt("RUN_MEMORY_LIMIT_MB"),
+		TimeoutSeconds: envInt("RUN_TIMEOUT_SECONDS"),
+	}
+	jobs.Default.Retry = db.RetryPolicy{
+		MaxAttempts:       envInt("JOB_RETRY_MAX_ATTEMPTS"),
+		BackoffSeconds:    envInt("JOB_RETRY_BACKOFF_SECONDS"),
+		MaxBackoffSeconds: envInt("JOB_RETRY_MAX_BACKOFF_SECONDS"),
+	}
+	if v := envInt("CONTAINER_RETENTION_SECONDS"); v > 0 {
+		jobs.Default.Retention = time.Duration(v) * time.Second
+	}
+	if v := os.Getenv("ORPHAN_POLICY"); v != "" {
+		jobs.Default.OrphanPolicy = v
+	}
+	// Допуск задаётся до запуска очереди: завершённые задания сразу загружают результаты.
+	db.FeasibilityTolerance = envFloat("FEASIBILITY_TOLERANCE")
+	if n, err := db.RefreshFeasibility(db.FeasibilityTolerance); err != nil {
+		log.Printf("Ошибка пересчёта допустимости результатов: %v", err)
+	} else if n > 0 {
+		log.Printf("Допустимость пересчитана для %d результатов", n)
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	if err := jobs.Default.Start(jobsCtx); err != nil {
+		log.Fatalf("Ошибка запуска очереди заданий: %v", err)
+	}
+	jobs.StartWorkerReaper(jobsCtx, time.Duration(envInt("WORKER_TIMEOUT_SECONDS"))*time.Second)
+	webhooks.NewDispatcher(envInt("WEBHOOK_MAX_ATTEMPTS")).Start(jobsCtx)
+	ingestion := ingest.NewService(resultsDir, time.Duration(envInt("RESULTS_SCAN_INTERVAL_SECONDS"))*time.Second)
+	ingestion.Start(jobsCtx)
 
 	r := router.NewRouter()
 
@@ -55,24 +103,57 @@ func main() {
 		Addr:    ":8080",
 		Handler: corsHandler(r),
 	}
+	server.RegisterOnShutdown(api.CloseEventStreams)
 
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 
+	serverErr := make(chan error, 1)
 	go func() {
 		log.Println("Запуск сервера на :8080")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Ошибка запуска сервера: %v", err)
+			serverErr <- err
 		}
 	}()
 
-	<-stopChan
-	log.Println("Получен сигнал остановки, завершаем работу сервера...")
+	// При любом исходе ниже останавливаются задания и загрузка результатов,
+	// чтобы не оставить наполовину перенесённую папку.
+	var failed bool
+	select {
+	case <-stopChan:
+		log.Println("Получен сигнал остановки, завершаем работу сервера...")
+	case err := <-serverErr:
+		log.Printf("Ошибка запуска сервера: %v", err)
+		failed = true
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Ошибка при завершении работы сервера: %v", err)
+		// Задания и загрузку результатов всё равно нужно остановить.
+		log.Printf("Ошибка при завершении работы сервера: %v", err)
 	}
+	stopJobs()
+	jobs.Default.Wait()
+	ingestion.Wait()
 	log.Println("Сервер остановлен.")
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func envInt(name string) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func envFloat(name string) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return 0
+	}
+	return v
 }
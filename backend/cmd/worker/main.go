@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/axywe/distributed-benchmarks/internal/agent"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+	"github.com/joho/godotenv"
+)
+
+// workerIDFile хранит суффикс имени воркера, если WORKER_NAME не задан.
+const workerIDFile = ".worker-id"
+
+func main() {
+	_ = godotenv.Load(".env")
+
+	backendURL := os.Getenv("BACKEND_URL")
+	token := os.Getenv("WORKER_TOKEN")
+	if backendURL == "" || token == "" {
+		log.Fatal("Не заданы BACKEND_URL и WORKER_TOKEN")
+	}
+
+	resultsDir := os.Getenv("WORKER_RESULTS_DIR")
+	if resultsDir == "" {
+		resultsDir = "worker-results"
+	}
+	name := os.Getenv("WORKER_NAME")
+	if name == "" {
+		var err error
+		if name, err = defaultName(resultsDir); err != nil {
+			log.Fatalf("Не задан WORKER_NAME: %v", err)
+		}
+	}
+
+	kind := os.Getenv("RUNNER")
+	if kind == "" {
+		kind = runner.KindDocker
+	}
+	r, err := runner.New(runner.Config{
+		Kind:       kind,
+		ResultsDir: resultsDir,
+		DockerHost: os.Getenv("DOCKER_HOST"),
+		Image:      os.Getenv("BENCH_IMAGE"),
+		Python:     os.Getenv("LOCAL_PYTHON"),
+		BenchDir:   os.Getenv("LOCAL_BENCH_DIR"),
+	})
+	if err != nil {
+		log.Fatalf("Ошибка настройки раннера: %v", err)
+	}
+
+	capacity, _ := strconv.Atoi(os.Getenv("WORKER_CAPACITY"))
+	a := agent.New(agent.NewClient(backendURL, token), r, kind, name, capacity)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Воркер %q подключается к %s", name, backendURL)
+	if err := a.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("Ошибка воркера: %v", err)
+	}
+	log.Println("Воркер остановлен.")
+}
+
+// defaultName возвращает имя воркера из имени хоста и случайного суффикса,
+// сохранённого в resultsDir. Бэкенд различает воркеров по имени, и без суффикса
+// два воркера на одном хосте перезапускали бы задания друг друга. Суффикс
+// переживает перезапуск, поэтому воркер остаётся тем же после рестарта.
+func defaultName(resultsDir string) (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(resultsDir, workerIDFile)
+	id, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		buf := make([]byte, 4)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		id = []byte(hex.EncodeToString(buf))
+		if err := os.MkdirAll(resultsDir, 0o755); err != nil {
+			return "", err
+		}
+		err = os.WriteFile(path, id, 0o644)
+	}
+	if err != nil {
+		return "", err
+	}
+	return host + "-" + strings.TrimSpace(string(id)), nil
+}
@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+	"github.com/axywe/distributed-benchmarks/internal/workerapi"
+)
+
+const (
+	DefaultPollInterval = 5 * time.Second
+	maxRetryDelay       = 30 * time.Second
+	errorTailLines      = 50
+)
+
+// Agent — удалённый воркер: регистрируется на бэкенде, берёт задания из
+// общей очереди, выполняет их локальным Runner и загружает результаты.
+type Agent struct {
+	API          *Client
+	Runner       runner.Runner
+	RunnerKind   string
+	Name         string
+	Capacity     int
+	PollInterval time.Duration
+
+	mu        sync.Mutex
+	workerID  int
+	heartbeat time.Duration
+	tasks     map[int]*task
+	wg        sync.WaitGroup
+}
+
+// task — задание, выполняющееся на этом воркере.
+type task struct {
+	cancel context.CancelFunc
+	// stopped выставляется, когда бэкенд попросил остановить задание.
+	stopped bool
+}
+
+func New(api *Client, r runner.Runner, runnerKind, name string, capacity int) *Agent {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &Agent{
+		API:          api,
+		Runner:       r,
+		RunnerKind:   runnerKind,
+		Name:         name,
+		Capacity:     capacity,
+		PollInterval: DefaultPollInterval,
+		tasks:        make(map[int]*task),
+	}
+}
+
+// Run работает до отмены ctx. При остановке выполняющиеся прогоны
+// прерываются без отчёта: бэкенд вернёт их задания в очередь.
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.register(ctx); err != nil {
+		return err
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.heartbeatLoop(ctx)
+	}()
+
+	slots := make(chan struct{}, a.Capacity)
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		lease, err := a.API.Lease(ctx, a.id())
+		if err != nil || lease == nil {
+			<-slots
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Ошибка получения задания: %v", err)
+				if IsStatus(err, http.StatusNotFound) {
+					_ = a.register(ctx)
+				}
+			}
+			sleep(ctx, a.PollInterval)
+			continue
+		}
+
+		log.Printf("Получено задание %d", lease.JobID)
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			defer func() { <-slots }()
+			a.execute(ctx, lease)
+		}()
+	}
+	a.wg.Wait()
+	return nil
+}
+
+// register повторяет регистрацию, пока бэкенд не ответит или не будет отменён ctx.
+func (a *Agent) register(ctx context.Context) error {
+	delay := time.Second
+	for {
+		resp, err := a.API.Register(ctx, workerapi.RegisterRequest{
+			Name:     a.Name,
+			Capacity: a.Capacity,
+			Runner:   a.RunnerKind,
+		})
+		if err == nil {
+			a.mu.Lock()
+			a.workerID = resp.WorkerID
+			a.heartbeat = time.Duration(resp.HeartbeatIntervalSeconds) * time.Second
+			a.mu.Unlock()
+			log.Printf("Воркер %q зарегистрирован, id %d", a.Name, resp.WorkerID)
+			return nil
+		}
+		log.Printf("Ошибка регистрации: %v, повтор через %v", err, delay)
+		if !sleep(ctx, delay) {
+			return ctx.Err()
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (a *Agent) id() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.workerID
+}
+
+func (a *Agent) heartbeatLoop(ctx context.Context) {
+	for {
+		a.mu.Lock()
+		interval := a.heartbeat
+		a.mu.Unlock()
+		if interval <= 0 {
+			interval = a.PollInterval
+		}
+		if !sleep(ctx, interval) {
+			return
+		}
+		// Бэкенд возвращает в очередь задания воркера, которых нет в списке,
+		// поэтому список собирается непосредственно перед отправкой.
+		a.mu.Lock()
+		running := make([]int, 0, len(a.tasks))
+		for id := range a.tasks {
+			running = append(running, id)
+		}
+		a.mu.Unlock()
+
+		stop, err := a.API.Heartbeat(ctx, a.id(), running)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Ошибка heartbeat: %v", err)
+			if IsStatus(err, http.StatusNotFound) {
+				_ = a.register(ctx)
+			}
+			continue
+		}
+		for _, id := range stop {
+			a.stop(id)
+		}
+	}
+}
+
+func (a *Agent) stop(jobID int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t := a.tasks[jobID]; t != nil {
+		log.Printf("Задание %d отменено на бэкенде, останавливаем", jobID)
+		t.stopped = true
+		t.cancel()
+	}
+}
+
+func (a *Agent) execute(ctx context.Context, lease *workerapi.Lease) {
+	workerID := a.id()
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t := &task{cancel: cancel}
+	a.mu.Lock()
+	a.tasks[lease.JobID] = t
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.tasks, lease.JobID)
+		a.mu.Unlock()
+	}()
+
+	handle, err := a.Runner.Run(taskCtx, runner.Spec{
+		Tag:  lease.Tag,
+		Args: lease.Args,
+		Limits: runner.Limits{
+			CPUs:     lease.CPUs,
+			MemoryMB: lease.MemoryMB,
+		},
+		Image:                lease.Image,
+		FeasibilityTolerance: lease.FeasibilityTolerance,
+	})
+	if err != nil {
+		log.Printf("Задание %d: %v", lease.JobID, err)
+		if ctx.Err() == nil {
+			a.complete(ctx, workerID, lease.JobID, runFailure(err))
+		}
+		return
+	}
+	defer a.cleanup(handle)
+
+	if err := a.API.Started(taskCtx, workerID, lease.JobID, handle.ID); err != nil {
+		log.Printf("Задание %d: %v, останавливаем прогон", lease.JobID, err)
+		return
+	}
+
+	waitCtx := taskCtx
+	if lease.TimeoutSeconds > 0 {
+		var cancelWait context.CancelFunc
+		waitCtx, cancelWait = context.WithTimeout(taskCtx, time.Duration(lease.TimeoutSeconds)*time.Second)
+		defer cancelWait()
+	}
+	code, err := a.Runner.Wait(waitCtx, handle)
+
+	a.mu.Lock()
+	stopped := t.stopped
+	a.mu.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("Задание %d прервано остановкой воркера", lease.JobID)
+	case stopped:
+	case waitCtx.Err() == context.DeadlineExceeded:
+		log.Printf("Задание %d превысило лимит времени %d с", lease.JobID, lease.TimeoutSeconds)
+		tail := a.logTail(handle)
+		a.complete(ctx, workerID, lease.JobID, workerapi.CompleteRequest{TimedOut: true, LogTail: tail})
+	case err != nil:
+		log.Printf("Задание %d: ошибка ожидания: %v", lease.JobID, err)
+		a.complete(ctx, workerID, lease.JobID, runFailure(err))
+	case code != 0:
+		// Результаты неудачной попытки не загружаются: повтор пойдёт под тем же тегом.
+		log.Printf("Задание %d завершилось с кодом %d", lease.JobID, code)
+		a.complete(ctx, workerID, lease.JobID, workerapi.CompleteRequest{ExitCode: &code, LogTail: a.logTail(handle)})
+	default:
+		a.saveLog(handle)
+		req := workerapi.CompleteRequest{ExitCode: &code}
+		if err := a.API.UploadResults(ctx, workerID, lease.JobID, handle.ResultsDir); err != nil {
+			log.Printf("Задание %d: ошибка загрузки результатов: %v", lease.JobID, err)
+			req.Error = "ошибка загрузки результатов: " + err.Error()
+			req.ExitCode = nil
+		}
+		a.complete(ctx, workerID, lease.JobID, req)
+	}
+}
+
+// runFailure описывает ошибку раннера для бэкенда.
+func runFailure(err error) workerapi.CompleteRequest {
+	return workerapi.CompleteRequest{Error: err.Error(), Transient: errors.Is(err, runner.ErrUnavailable)}
+}
+
+// complete повторяет отправку итога задания, пока бэкенд не подтвердит её,
+// не отклонит запрос или не будет отменён ctx. Пока итог не принят, задание
+// остаётся в tasks и попадает в heartbeat, чтобы бэкенд не счёл его потерянным.
+func (a *Agent) complete(ctx context.Context, workerID, jobID int, req workerapi.CompleteRequest) {
+	delay := time.Second
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := a.API.Complete(attemptCtx, workerID, jobID, req)
+		cancel()
+		if err == nil {
+			return
+		}
+		if se, ok := err.(*StatusError); ok && se.StatusCode >= 400 && se.StatusCode < 500 {
+			log.Printf("Задание %d: бэкенд отклонил результат: %v", jobID, err)
+			return
+		}
+		log.Printf("Задание %d: ошибка отправки результата: %v, повтор через %v", jobID, err, delay)
+		if !sleep(ctx, delay) {
+			return
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// cleanup останавливает прогон и удаляет его локальную папку результатов.
+func (a *Agent) cleanup(handle *runner.Handle) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := a.Runner.Stop(ctx, handle); err != nil {
+		log.Printf("%v", err)
+	}
+	if err := os.RemoveAll(handle.ResultsDir); err != nil {
+		log.Printf("Ошибка удаления %s: %v", handle.ResultsDir, err)
+	}
+}
+
+// saveLog сохраняет лог прогона в run.log, если раннер не пишет его сам.
+func (a *Agent) saveLog(handle *runner.Handle) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := runner.SaveLog(ctx, a.Runner, filepath.Dir(handle.ResultsDir), handle); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+func (a *Agent) logTail(handle *runner.Handle) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return runner.LogTail(ctx, a.Runner, handle.Name, errorTailLines)
+}
+
+// sleep ждёт d и возвращает false, если ctx отменён раньше.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
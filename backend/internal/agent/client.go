@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/workerapi"
+)
+
+// Client обращается к API воркеров бэкенда (/api/v1/workers).
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+// StatusError — ответ бэкенда с кодом ошибки.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("бэкенд ответил %d: %s", e.StatusCode, e.Message)
+}
+
+// IsStatus проверяет, что err — ответ бэкенда с указанным кодом.
+func IsStatus(err error, code int) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.StatusCode == code
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/") + "/api/v1/workers",
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (c *Client) Register(ctx context.Context, req workerapi.RegisterRequest) (*workerapi.RegisterResponse, error) {
+	var resp workerapi.RegisterResponse
+	if _, err := c.post(ctx, "/register", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Heartbeat(ctx context.Context, workerID int, running []int) ([]int, error) {
+	var resp workerapi.HeartbeatResponse
+	if _, err := c.post(ctx, fmt.Sprintf("/%d/heartbeat", workerID), workerapi.HeartbeatRequest{Running: running}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Cancel, nil
+}
+
+// Lease запрашивает задание. Возвращает nil, если очередь пуста или лимит исчерпан.
+func (c *Client) Lease(ctx context.Context, workerID int) (*workerapi.Lease, error) {
+	var lease workerapi.Lease
+	status, err := c.post(ctx, fmt.Sprintf("/%d/lease", workerID), struct{}{}, &lease)
+	if err != nil || status == http.StatusNoContent {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (c *Client) Started(ctx context.Context, workerID, jobID int, containerID string) error {
+	_, err := c.post(ctx, fmt.Sprintf("/%d/jobs/%d/started", workerID, jobID), workerapi.StartedRequest{ContainerID: containerID}, nil)
+	return err
+}
+
+func (c *Client) Complete(ctx context.Context, workerID, jobID int, req workerapi.CompleteRequest) error {
+	_, err := c.post(ctx, fmt.Sprintf("/%d/jobs/%d/complete", workerID, jobID), req, nil)
+	return err
+}
+
+// UploadResults отправляет файлы из dir, перечисленные в workerapi.ResultFiles.
+func (c *Client) UploadResults(ctx context.Context, workerID, jobID int, dir string) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, name := range workerapi.ResultFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		part, err := mw.CreateFormFile(name, name)
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.BaseURL+fmt.Sprintf("/%d/jobs/%d/results", workerID, jobID), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	_, err = c.do(req, nil)
+	return err
+}
+
+func (c *Client) post(ctx context.Context, path string, in, out interface{}) (int, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
+
+func (c *Client) do(req *http.Request, out interface{}) (int, error) {
+	req.Header.Set(workerapi.TokenHeader, c.Token)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Ответы бэкенда обёрнуты в helpers.APIResponse.
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+		Meta struct {
+			Message string `json:"message"`
+		} `json:"meta"`
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &envelope) == nil && envelope.Meta.Message != "" {
+			message = envelope.Meta.Message
+		}
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode, Message: message}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return resp.StatusCode, fmt.Errorf("ошибка разбора ответа бэкенда: %v", err)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("ошибка разбора ответа бэкенда: %v", err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// JobAttempt — одна завершённая попытка выполнения задания.
+type JobAttempt struct {
+	Attempt    int        `json:"attempt"`
+	Status     string     `json:"status"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	ErrorTail  string     `json:"error_tail,omitempty"`
+	WorkerID   int        `json:"worker_id,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time  `json:"finished_at"`
+}
+
+// recordJobAttempt сохраняет текущую попытку задания с кодом выхода и
+// хвостом лога, уже записанными в jobs.
+func recordJobAttempt(ex execer, jobID int, status string) error {
+	_, err := ex.Exec(`
+INSERT INTO job_attempts (job_id, attempt, status, exit_code, error_tail, worker_id, started_at)
+SELECT id, attempt, $2, exit_code, error_tail, worker_id, started_at FROM jobs WHERE id = $1
+ON CONFLICT (job_id, attempt) DO NOTHING
+`, jobID, status)
+	if err != nil {
+		return fmt.Errorf("ошибка записи попытки задания %d: %v", jobID, err)
+	}
+	return nil
+}
+
+// RetryJob записывает неудачную попытку выполняющегося задания и возвращает
+// его в очередь; следующая попытка будет выдана не раньше чем через delay.
+func RetryJob(id int, exitCode *int, errorTail string, delay time.Duration) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var code interface{}
+	if exitCode != nil {
+		code = *exitCode
+	}
+	res, err := tx.Exec(`
+UPDATE jobs SET exit_code = $2, error_tail = $3 WHERE id = $1 AND status = $4
+`, id, code, errorTail, JobRunning)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления задания %d: %v", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if err := recordJobAttempt(tx, id, JobFailed); err != nil {
+		return err
+	}
+
+	var attempt int
+	err = tx.QueryRow(`
+UPDATE jobs SET status = $2, attempt = attempt + 1, not_before = now() + make_interval(secs => $3),
+       started_at = NULL, container_id = '', worker_id = NULL
+WHERE id = $1
+RETURNING attempt
+`, id, JobQueued, delay.Seconds()).Scan(&attempt)
+	if err != nil {
+		return fmt.Errorf("ошибка возврата задания %d в очередь: %v", id, err)
+	}
+	message := fmt.Sprintf("попытка %d через %v", attempt, delay)
+	if err := recordJobEvent(tx, id, JobQueued, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func GetJobAttempts(jobID int) ([]JobAttempt, error) {
+	rows, err := DB.Query(`
+SELECT attempt, status, exit_code, error_tail, worker_id, started_at, finished_at
+FROM job_attempts
+WHERE job_id = $1
+ORDER BY attempt
+`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса попыток задания: %v", err)
+	}
+	defer rows.Close()
+
+	var attempts []JobAttempt
+	for rows.Next() {
+		var a JobAttempt
+		var exitCode, workerID sql.NullInt64
+		var startedAt sql.NullTime
+		if err := rows.Scan(&a.Attempt, &a.Status, &exitCode, &a.ErrorTail, &workerID, &startedAt, &a.FinishedAt); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования попытки: %v", err)
+		}
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			a.ExitCode = &code
+		}
+		a.WorkerID = int(workerID.Int64)
+		if startedAt.Valid {
+			a.StartedAt = &startedAt.Time
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
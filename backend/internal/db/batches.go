@@ -0,0 +1,143 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// BatchGrid — пакет, развёрнутый в декартово произведение значений параметров.
+	BatchGrid = "grid"
+	// BatchSweep — подбор гиперпараметров выборкой из заданных границ.
+	BatchSweep = "sweep"
+)
+
+// Batch группирует задания, поставленные одним пакетным запросом. Для
+// дневного лимита запусков и отмены пакет считается одной единицей; бюджет
+// квоты складывается из бюджетов его прогонов.
+type Batch struct {
+	ID           int                    `json:"id"`
+	UserID       int                    `json:"user_id,omitempty"`
+	ExperimentID int                    `json:"experiment_id,omitempty"`
+	Kind         string                 `json:"kind"`
+	Spec         map[string]interface{} `json:"spec"`
+	Total        int                    `json:"total"`
+	Cached       int                    `json:"cached"`
+	Invalid      int                    `json:"invalid"`
+	CreatedAt    time.Time              `json:"created_at"`
+	FinishedAt   *time.Time             `json:"finished_at,omitempty"`
+	Counts       map[string]int         `json:"counts,omitempty"`
+	Jobs         []Job                  `json:"jobs,omitempty"`
+}
+
+const batchColumns = `id, user_id, experiment_id, kind, spec, total, cached, invalid, created_at, finished_at`
+
+func scanBatch(row rowScanner) (*Batch, error) {
+	var b Batch
+	var userID, experimentID sql.NullInt64
+	var rawSpec []byte
+	var finishedAt sql.NullTime
+	if err := row.Scan(&b.ID, &userID, &experimentID, &b.Kind, &rawSpec, &b.Total, &b.Cached, &b.Invalid, &b.CreatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		b.FinishedAt = &finishedAt.Time
+	}
+	b.UserID = int(userID.Int64)
+	b.ExperimentID = int(experimentID.Int64)
+	if err := json.Unmarshal(rawSpec, &b.Spec); err != nil {
+		return nil, fmt.Errorf("ошибка разбора спецификации пакета %d: %v", b.ID, err)
+	}
+	return &b, nil
+}
+
+// InsertBatch сохраняет пакет и ставит его задания в очередь одной
+// транзакцией. Квота check проверяется, только если ставить есть что.
+func InsertBatch(b *Batch, jobs []*Job, check QuotaCheck) (int, error) {
+	raw, err := json.Marshal(b.Spec)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сериализации спецификации пакета: %v", err)
+	}
+	var userID, experimentID interface{}
+	if b.UserID > 0 {
+		userID = b.UserID
+	}
+	if b.ExperimentID > 0 {
+		experimentID = b.ExperimentID
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if len(jobs) > 0 {
+		if err := checkQuota(tx, b.UserID, check); err != nil {
+			return 0, err
+		}
+	}
+	var id int
+	err = tx.QueryRow(`
+INSERT INTO batches (user_id, experiment_id, kind, spec, total, cached, invalid)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id
+`, userID, experimentID, b.Kind, raw, b.Total, b.Cached, b.Invalid).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания пакета: %v", err)
+	}
+	for _, j := range jobs {
+		j.BatchID = id
+		if _, err := insertJob(tx, j); err != nil {
+			return 0, err
+		}
+	}
+	b.ID = id
+	return id, tx.Commit()
+}
+
+func GetBatch(id int) (*Batch, error) {
+	b, err := scanBatch(DB.QueryRow(`SELECT `+batchColumns+` FROM batches WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пакета: %v", err)
+	}
+	return b, nil
+}
+
+// GetBatchesByUser возвращает пакеты пользователя, новые первыми.
+func GetBatchesByUser(userID, limit, offset int) ([]Batch, error) {
+	rows, err := DB.Query(`
+SELECT `+batchColumns+` FROM batches
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT $2 OFFSET $3
+`, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса пакетов: %v", err)
+	}
+	defer rows.Close()
+
+	var batches []Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования пакета: %v", err)
+		}
+		batches = append(batches, *b)
+	}
+	return batches, rows.Err()
+}
+
+func GetBatchJobs(batchID int) ([]Job, error) {
+	rows, err := DB.Query(`SELECT `+jobColumns+` FROM jobs WHERE batch_id = $1 ORDER BY id`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса заданий пакета: %v", err)
+	}
+	defer rows.Close()
+	return scanJobs(rows)
+}
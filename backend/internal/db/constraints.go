@@ -0,0 +1,229 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// FeasibilityTolerance — допустимое нарушение каждого ограничения. Ограничения
+// записываются как g ≤ 0, точка допустима, если все g ≤ FeasibilityTolerance.
+var FeasibilityTolerance float64
+
+// FeasibleScope в параметрах SearchOptimizationResultsWithRange оставляет
+// только допустимые (true) или только недопустимые (false) результаты.
+type FeasibleScope bool
+
+// ViolationRange в параметрах SearchOptimizationResultsWithRange ограничивает
+// суммарное нарушение ограничений лучшей точки.
+type ViolationRange NumericRange
+
+// applyFeasibility выбирает лучшую точку результата с учётом ограничений и
+// заполняет ConstraintNames, ConstraintValues, ConstraintViolation и Feasible.
+// Лучшей считается лексикографически минимальная по целям допустимая точка, а
+// если допустимых нет — точка с наименьшим суммарным нарушением. Без истории
+// оценивается best_result, выбранный run.py.
+func applyFeasibility(res *OptimizationResult, tol float64) {
+	if h := res.History; h != nil {
+		if i := bestEvaluation(h, tol); i >= 0 {
+			res.BestResult = h.bestResult(i)
+		}
+	}
+
+	var names []string
+	for name := range res.BestResult {
+		if !strings.HasPrefix(name, "x[") && !strings.HasPrefix(name, "f[") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(a, b int) bool { return columnLess(names[a], names[b]) })
+	res.ConstraintNames = []string{}
+	res.ConstraintValues = []float64{}
+	res.ConstraintViolation = 0
+	res.Feasible = true
+	for _, name := range names {
+		g := res.BestResult[name]
+		res.ConstraintNames = append(res.ConstraintNames, name)
+		res.ConstraintValues = append(res.ConstraintValues, g)
+		res.ConstraintViolation += constraintViolation(g)
+		if !(g <= tol) {
+			res.Feasible = false
+		}
+	}
+}
+
+// RefreshFeasibility пересчитывает лучшую точку, допустимость и фронт Парето
+// результатов, загруженных с другим допуском, чем tol. Вызывается при старте
+// сервера, пока загрузка результатов не запущена. Возвращает число обновлённых
+// результатов.
+func RefreshFeasibility(tol float64) (int, error) {
+	rows, err := DB.Query(`SELECT result_id FROM optimization_results WHERE feasibility_tolerance <> $1`, tol)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка запроса результатов для пересчёта допустимости: %v", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка сканирования результата: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := refreshFeasibility(id, tol); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+func refreshFeasibility(resultID string, tol float64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var res OptimizationResult
+	var bestX, objectives, constraints []float64
+	var bestF float64
+	var names []string
+	err = tx.QueryRow(`
+SELECT best_result_x, best_result_f, best_result_objectives, constraint_names, constraint_values
+FROM optimization_results WHERE result_id = $1 FOR UPDATE
+`, resultID).Scan(pq.Array(&bestX), &bestF, pq.Array(&objectives), pq.Array(&names), pq.Array(&constraints))
+	if err != nil {
+		return fmt.Errorf("ошибка получения результата %s: %v", resultID, err)
+	}
+	res.BestResult = bestResultMap(bestX, bestF, objectives, names, constraints)
+	if res.History, err = loadHistory(tx, resultID); err != nil {
+		return err
+	}
+	applyFeasibility(&res, tol)
+
+	_, err = tx.Exec(`
+UPDATE optimization_results
+SET best_result_x = $2, best_result_f = $3, best_result_objectives = $4,
+    constraint_names = $5, constraint_values = $6, constraint_violation = $7,
+    feasible = $8, feasibility_tolerance = $9
+WHERE result_id = $1
+`, resultID, pq.Array(parseBestX(res.BestResult)), parseBestF(res.BestResult),
+		pq.Array(parseBestObjectives(res.BestResult)), pq.Array(res.ConstraintNames),
+		pq.Array(res.ConstraintValues), res.ConstraintViolation, res.Feasible, tol)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления допустимости %s: %v", resultID, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM pareto_points WHERE result_id = $1`, resultID); err != nil {
+		return fmt.Errorf("ошибка удаления фронта Парето %s: %v", resultID, err)
+	}
+	if res.History != nil {
+		if err := insertParetoFront(tx, resultID, res.History, tol); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// bestEvaluation возвращает номер лучшего вычисления истории (с 0) или -1,
+// если ни одно вычисление не содержит всех значений.
+func bestEvaluation(h *History, tol float64) int {
+	best := -1
+	var bestFeasible bool
+	var bestViolation float64
+	for i := 0; i < h.Evaluations; i++ {
+		if !rowFinite(h.X, i) || !rowFinite(h.F, i) || !rowFinite(h.G, i) {
+			continue
+		}
+		feasible, violation := rowFeasibility(h, i, tol)
+		if feasible {
+			violation = 0
+		}
+		switch {
+		case best < 0,
+			feasible && !bestFeasible,
+			feasible == bestFeasible && violation < bestViolation,
+			feasible == bestFeasible && violation == bestViolation && lexLess(h.F, i, best):
+			best, bestFeasible, bestViolation = i, feasible, violation
+		}
+	}
+	return best
+}
+
+// rowFeasibility возвращает допустимость вычисления и суммарное нарушение max(0, g).
+func rowFeasibility(h *History, i int, tol float64) (bool, float64) {
+	feasible := true
+	var total float64
+	for _, c := range h.G {
+		if !(c[i] <= tol) {
+			feasible = false
+		}
+		total += constraintViolation(c[i])
+	}
+	return feasible, total
+}
+
+// constraintViolation возвращает нарушение ограничения max(0, g). NaN делает точку
+// недопустимой, но в сумму не входит, иначе она не сериализуется в JSON.
+func constraintViolation(g float64) float64 {
+	if g > 0 {
+		return g
+	}
+	return 0
+}
+
+func lexLess(cols [][]float64, a, b int) bool {
+	for _, c := range cols {
+		if c[a] != c[b] {
+			return c[a] < c[b]
+		}
+	}
+	return false
+}
+
+// bestResult собирает best_result из вычисления i в том виде, в каком его пишет run.py.
+func (h *History) bestResult(i int) map[string]float64 {
+	br := make(map[string]float64, len(h.XNames)+len(h.FNames)+len(h.GNames))
+	for j, name := range h.XNames {
+		br[name] = h.X[j][i]
+	}
+	for j, name := range h.FNames {
+		br[name] = h.F[j][i]
+	}
+	for j, name := range h.GNames {
+		br[name] = h.G[j][i]
+	}
+	return br
+}
+
+// columnLess упорядочивает имена вида g[2] и g[10] по номеру в скобках.
+func columnLess(a, b string) bool {
+	pa, na := splitColumn(a)
+	pb, nb := splitColumn(b)
+	if pa != pb {
+		return pa < pb
+	}
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+func splitColumn(name string) (string, int) {
+	open := strings.IndexByte(name, '[')
+	if open < 0 || !strings.HasSuffix(name, "]") {
+		return name, -1
+	}
+	n, err := strconv.Atoi(name[open+1 : len(name)-1])
+	if err != nil {
+		return name, -1
+	}
+	return name[:open], n
+}
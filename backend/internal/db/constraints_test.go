@@ -0,0 +1,131 @@
+package db
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBestEvaluation(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name string
+		f    [][]float64
+		g    [][]float64
+		tol  float64
+		want int
+	}{
+		{"unconstrained lexicographic minimum", [][]float64{{1, 5}, {1, 3}, {2, 0}}, nil, 0, 1},
+		{"first of equal points", [][]float64{{1}, {1}}, nil, 0, 0},
+		{"constraint equal to tolerance is feasible", [][]float64{{1}, {2}}, [][]float64{{0.1}, {-1}}, 0.1, 0},
+		{"constraint just above tolerance is infeasible", [][]float64{{1}, {2}}, [][]float64{{math.Nextafter(0.1, 1)}, {-1}}, 0.1, 1},
+		{"zero tolerance", [][]float64{{1}, {2}}, [][]float64{{1e-12}, {0}}, 0, 1},
+		// Нарушение в пределах допуска не должно проигрывать строго допустимой точке.
+		{"violation within tolerance not penalised", [][]float64{{1}, {2}}, [][]float64{{0.05}, {-1}}, 0.1, 0},
+		{"feasible beats lower objective", [][]float64{{0}, {5}}, [][]float64{{1}, {0}}, 0, 1},
+		{"all infeasible picks lowest violation", [][]float64{{0}, {5}, {1}}, [][]float64{{2}, {0.5}, {1}}, 0, 1},
+		{"all infeasible sums violations", [][]float64{{0}, {1}}, [][]float64{{1, 1}, {1.5, -10}}, 0, 1},
+		{"all infeasible tie broken by objectives", [][]float64{{3}, {2}}, [][]float64{{1}, {1}}, 0, 1},
+		{"NaN constraint row skipped", [][]float64{{0}, {1}}, [][]float64{{nan}, {0.5}}, 0, 1},
+		{"NaN objective row skipped", [][]float64{{nan}, {1}}, [][]float64{{-1}, {-1}}, 0, 1},
+		{"all rows NaN", [][]float64{{0}, {1}}, [][]float64{{nan}, {nan}}, 0, -1},
+		{"empty history", nil, nil, 0, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(xs(len(tt.f)), tt.f, tt.g)
+			if got := bestEvaluation(h, tt.tol); got != tt.want {
+				t.Errorf("bestEvaluation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFeasibilityWithHistory(t *testing.T) {
+	h := newHistory(
+		[][]float64{{0.5}, {1.5}, {2.5}},
+		[][]float64{{0}, {1}, {2}},
+		[][]float64{{3, 0}, {0.1, -2}, {-1, -1}},
+	)
+	h.XNames = []string{"x[0]"}
+	h.FNames = []string{"f[0]"}
+	h.GNames = []string{"g[0]", "g[1]"}
+	res := OptimizationResult{
+		BestResult: map[string]float64{"x[0]": 0.5, "f[0]": 0, "g[0]": 3, "g[1]": 0},
+		History:    h,
+	}
+	applyFeasibility(&res, 0.1)
+
+	want := map[string]float64{"x[0]": 1.5, "f[0]": 1, "g[0]": 0.1, "g[1]": -2}
+	if !reflect.DeepEqual(res.BestResult, want) {
+		t.Errorf("BestResult = %v, want %v", res.BestResult, want)
+	}
+	if !res.Feasible {
+		t.Error("Feasible = false, want true")
+	}
+	if res.ConstraintViolation != 0.1 {
+		t.Errorf("ConstraintViolation = %v, want 0.1", res.ConstraintViolation)
+	}
+}
+
+func TestApplyFeasibilityAllInfeasibleHistory(t *testing.T) {
+	h := newHistory(
+		[][]float64{{0}, {1}},
+		[][]float64{{0}, {1}},
+		[][]float64{{2}, {0.5}},
+	)
+	h.XNames = []string{"x[0]"}
+	h.FNames = []string{"f[0]"}
+	h.GNames = []string{"g[0]"}
+	res := OptimizationResult{History: h}
+	applyFeasibility(&res, 0)
+
+	if res.Feasible {
+		t.Error("Feasible = true, want false")
+	}
+	if res.ConstraintViolation != 0.5 {
+		t.Errorf("ConstraintViolation = %v, want 0.5", res.ConstraintViolation)
+	}
+	if res.BestResult["x[0]"] != 1 {
+		t.Errorf("best x[0] = %v, want 1", res.BestResult["x[0]"])
+	}
+}
+
+func TestApplyFeasibilityWithoutHistory(t *testing.T) {
+	tests := []struct {
+		name          string
+		constraints   map[string]float64
+		tol           float64
+		wantNames     []string
+		wantFeasible  bool
+		wantViolation float64
+	}{
+		{"no constraints", nil, 0, []string{}, true, 0},
+		{"numeric order of names", map[string]float64{"g[10]": -1, "g[2]": -2, "g[1]": -3}, 0, []string{"g[1]", "g[2]", "g[10]"}, true, 0},
+		{"equal to tolerance", map[string]float64{"g[0]": 0.1, "g[1]": -3}, 0.1, []string{"g[0]", "g[1]"}, true, 0.1},
+		{"just above tolerance", map[string]float64{"g[0]": math.Nextafter(0.1, 1)}, 0.1, []string{"g[0]"}, false, math.Nextafter(0.1, 1)},
+		{"violations summed", map[string]float64{"g[0]": 1, "g[1]": 2, "g[2]": -5}, 0, []string{"g[0]", "g[1]", "g[2]"}, false, 3},
+		{"NaN is infeasible", map[string]float64{"g[0]": math.NaN(), "g[1]": 1}, 10, []string{"g[0]", "g[1]"}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := OptimizationResult{BestResult: map[string]float64{"x[0]": 1, "f[0]": 2}}
+			for name, g := range tt.constraints {
+				res.BestResult[name] = g
+			}
+			applyFeasibility(&res, tt.tol)
+			if !reflect.DeepEqual(res.ConstraintNames, tt.wantNames) {
+				t.Errorf("ConstraintNames = %v, want %v", res.ConstraintNames, tt.wantNames)
+			}
+			if len(res.ConstraintValues) != len(tt.wantNames) {
+				t.Errorf("ConstraintValues = %v, want %d values", res.ConstraintValues, len(tt.wantNames))
+			}
+			if res.Feasible != tt.wantFeasible {
+				t.Errorf("Feasible = %v, want %v", res.Feasible, tt.wantFeasible)
+			}
+			if res.ConstraintViolation != tt.wantViolation {
+				t.Errorf("ConstraintViolation = %v, want %v", res.ConstraintViolation, tt.wantViolation)
+			}
+		})
+	}
+}
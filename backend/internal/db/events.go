@@ -0,0 +1,168 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Типы событий потока GET /api/v1/events.
+const (
+	UserEventQueued       = "queued"
+	UserEventStarted      = "started"
+	UserEventFinished     = "finished"
+	UserEventIngested     = "ingested"
+	UserEventIngestFailed = "ingest_failed"
+	UserEventCacheHit     = "cache_hit"
+)
+
+// UserEvent — событие жизненного цикла задания или попадание в кэш. ID
+// возрастает общим счётчиком для обоих видов и служит Last-Event-ID.
+type UserEvent struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	Status       string    `json:"status,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	JobID        int       `json:"job_id,omitempty"`
+	Tag          string    `json:"tag,omitempty"`
+	UserID       int       `json:"user_id,omitempty"`
+	BatchID      int       `json:"batch_id,omitempty"`
+	ExperimentID int       `json:"experiment_id,omitempty"`
+	ResultIDs    []string  `json:"result_ids,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	XID          int64     `json:"-"`
+}
+
+// EventCursor — позиция в потоке событий: транзакция, записавшая последнее
+// отданное событие, и его ID.
+//
+// ID выдаются при вставке, а видны события после фиксации транзакции, поэтому
+// событие с меньшим ID может появиться позже большего. Поток идёт в порядке
+// (XID, ID) и отдаёт только события транзакций старше самой старой
+// незавершённой: такие уже не появятся позади курсора.
+type EventCursor struct {
+	XID int64
+	ID  int64
+}
+
+// Cursor возвращает позицию сразу после события.
+func (e UserEvent) Cursor() EventCursor {
+	return EventCursor{XID: e.XID, ID: e.ID}
+}
+
+// eventType переводит статус из job_events в тип события потока.
+func eventType(status string) string {
+	switch status {
+	case JobQueued:
+		return UserEventQueued
+	case JobRunning:
+		return UserEventStarted
+	case JobIngested:
+		return UserEventIngested
+	case JobIngestFailed:
+		return UserEventIngestFailed
+	}
+	return UserEventFinished
+}
+
+// RecordCacheHit записывает, что запуск пользователя был закрыт готовыми
+// результатами. batchID равен 0 для одиночного запуска.
+func RecordCacheHit(userID, batchID, experimentID int, resultIDs []string) error {
+	if userID == 0 {
+		return nil
+	}
+	var batch, experiment interface{}
+	if batchID > 0 {
+		batch = batchID
+	}
+	if experimentID > 0 {
+		experiment = experimentID
+	}
+	_, err := DB.Exec(`
+INSERT INTO cache_hits (user_id, batch_id, experiment_id, result_ids) VALUES ($1, $2, $3, $4)
+`, userID, batch, experiment, pq.Array(resultIDs))
+	if err != nil {
+		return fmt.Errorf("ошибка записи попадания в кэш: %v", err)
+	}
+	return nil
+}
+
+// CurrentEventCursor возвращает позицию, после которой идут только события
+// транзакций, не завершённых к моменту вызова.
+func CurrentEventCursor() (EventCursor, error) {
+	var xmin int64
+	err := DB.QueryRow(`SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&xmin)
+	if err != nil {
+		return EventCursor{}, fmt.Errorf("ошибка получения позиции потока событий: %v", err)
+	}
+	return EventCursor{XID: xmin - 1, ID: math.MaxInt64}, nil
+}
+
+// EventCursorAt возвращает позицию сразу после события id. Если событие уже
+// удалено вместе с заданием, берётся ближайшее предыдущее; если нет и его,
+// поток начнётся сначала.
+func EventCursorAt(id int64) (EventCursor, error) {
+	var c EventCursor
+	err := DB.QueryRow(`
+SELECT xid, id FROM job_events WHERE id <= $1
+UNION ALL
+SELECT xid, id FROM cache_hits WHERE id <= $1
+ORDER BY id DESC
+LIMIT 1
+`, id).Scan(&c.XID, &c.ID)
+	if err == sql.ErrNoRows {
+		return EventCursor{}, nil
+	}
+	if err != nil {
+		return EventCursor{}, fmt.Errorf("ошибка получения события %d: %v", id, err)
+	}
+	return c, nil
+}
+
+// GetUserEvents возвращает до limit событий после позиции after в порядке
+// фиксации транзакций (см. EventCursor). userID 0 означает события всех
+// пользователей.
+func GetUserEvents(userID int, after EventCursor, limit int) ([]UserEvent, error) {
+	rows, err := DB.Query(`
+WITH horizon AS (SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint AS xmin)
+SELECT e.id AS id, e.status, e.message, j.id, j.tag, j.user_id, j.batch_id, j.experiment_id, NULL::TEXT[],
+       e.created_at, e.xid AS xid
+FROM job_events e
+JOIN jobs j ON j.id = e.job_id
+WHERE (e.xid, e.id) > ($2, $3) AND e.xid < (SELECT xmin FROM horizon) AND ($1 = 0 OR j.user_id = $1)
+UNION ALL
+SELECT c.id, '', '', NULL, '', c.user_id, c.batch_id, c.experiment_id, c.result_ids, c.created_at, c.xid
+FROM cache_hits c
+WHERE (c.xid, c.id) > ($2, $3) AND c.xid < (SELECT xmin FROM horizon) AND ($1 = 0 OR c.user_id = $1)
+ORDER BY xid, id
+LIMIT $4
+`, userID, after.XID, after.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса событий: %v", err)
+	}
+	defer rows.Close()
+
+	var events []UserEvent
+	for rows.Next() {
+		var e UserEvent
+		var jobID, owner, batchID, experimentID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Status, &e.Message, &jobID, &e.Tag, &owner, &batchID, &experimentID,
+			pq.Array(&e.ResultIDs), &e.CreatedAt, &e.XID); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования события: %v", err)
+		}
+		e.JobID = int(jobID.Int64)
+		e.UserID = int(owner.Int64)
+		e.BatchID = int(batchID.Int64)
+		e.ExperimentID = int(experimentID.Int64)
+		if e.JobID != 0 {
+			e.Type = eventType(e.Status)
+		} else {
+			e.Type = UserEventCacheHit
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Experiment объединяет прогоны одного исследования. Результаты привязываются
+// к эксперименту через experiment_results: сюда попадают и результаты
+// заданий эксперимента, и найденные в кэше.
+type Experiment struct {
+	ID          int            `json:"id"`
+	UserID      int            `json:"user_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Tags        []string       `json:"tags"`
+	Archived    bool           `json:"archived"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Jobs        map[string]int `json:"jobs,omitempty"`
+	Results     int            `json:"results"`
+}
+
+// ExperimentScope в параметрах SearchOptimizationResultsWithRange ограничивает
+// поиск результатами эксперимента.
+type ExperimentScope int
+
+const experimentColumns = `e.id, e.user_id, e.name, e.description, e.tags, e.archived, e.created_at, e.updated_at,
+       (SELECT count(*) FROM experiment_results er WHERE er.experiment_id = e.id)`
+
+func scanExperiment(row rowScanner) (*Experiment, error) {
+	var e Experiment
+	if err := row.Scan(
+		&e.ID, &e.UserID, &e.Name, &e.Description, pq.Array(&e.Tags), &e.Archived,
+		&e.CreatedAt, &e.UpdatedAt, &e.Results,
+	); err != nil {
+		return nil, err
+	}
+	if e.Tags == nil {
+		e.Tags = []string{}
+	}
+	return &e, nil
+}
+
+func InsertExperiment(e *Experiment) (int, error) {
+	if e.Tags == nil {
+		e.Tags = []string{}
+	}
+	var id int
+	err := DB.QueryRow(`
+INSERT INTO experiments (user_id, name, description, tags)
+VALUES ($1, $2, $3, $4)
+RETURNING id
+`, e.UserID, e.Name, e.Description, pq.Array(e.Tags)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания эксперимента: %v", err)
+	}
+	return id, nil
+}
+
+func GetExperiment(id int) (*Experiment, error) {
+	e, err := scanExperiment(DB.QueryRow(`SELECT `+experimentColumns+` FROM experiments e WHERE e.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения эксперимента: %v", err)
+	}
+	return e, nil
+}
+
+// GetExperimentsByUser возвращает эксперименты пользователя, новые первыми.
+// Пустой tag не фильтрует по тегам.
+func GetExperimentsByUser(userID int, archived bool, tag string) ([]Experiment, error) {
+	rows, err := DB.Query(`
+SELECT `+experimentColumns+` FROM experiments e
+WHERE e.user_id = $1 AND e.archived = $2 AND ($3 = '' OR $3 = ANY(e.tags))
+ORDER BY e.id DESC
+`, userID, archived, tag)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса экспериментов: %v", err)
+	}
+	defer rows.Close()
+
+	experiments := []Experiment{}
+	for rows.Next() {
+		e, err := scanExperiment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования эксперимента: %v", err)
+		}
+		experiments = append(experiments, *e)
+	}
+	return experiments, rows.Err()
+}
+
+func UpdateExperiment(e *Experiment) error {
+	if e.Tags == nil {
+		e.Tags = []string{}
+	}
+	_, err := DB.Exec(`
+UPDATE experiments
+SET name = $2, description = $3, tags = $4, archived = $5, updated_at = now()
+WHERE id = $1
+`, e.ID, e.Name, e.Description, pq.Array(e.Tags), e.Archived)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления эксперимента %d: %v", e.ID, err)
+	}
+	return nil
+}
+
+// AttachExperimentResults привязывает существующие результаты к эксперименту.
+func AttachExperimentResults(experimentID int, resultIDs []string) error {
+	_, err := DB.Exec(`
+INSERT INTO experiment_results (experiment_id, result_id)
+SELECT $1, result_id FROM optimization_results WHERE result_id = ANY($2)
+ON CONFLICT DO NOTHING
+`, experimentID, pq.Array(resultIDs))
+	if err != nil {
+		return fmt.Errorf("ошибка привязки результатов к эксперименту %d: %v", experimentID, err)
+	}
+	return nil
+}
+
+func GetExperimentResultIDs(experimentID int) ([]string, error) {
+	rows, err := DB.Query(`
+SELECT er.result_id FROM experiment_results er
+JOIN optimization_results r ON r.result_id = er.result_id
+WHERE er.experiment_id = $1
+ORDER BY r.best_result_f
+`, experimentID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса результатов эксперимента: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetExperimentJobCounts возвращает число заданий эксперимента по состояниям.
+func GetExperimentJobCounts(experimentID int) (map[string]int, error) {
+	rows, err := DB.Query(`
+SELECT status, count(*) FROM jobs WHERE experiment_id = $1 GROUP BY status
+`, experimentID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчёта заданий эксперимента: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
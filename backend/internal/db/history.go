@@ -0,0 +1,315 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// History — история вычислений запуска из results.csv. Значения хранятся по
+// столбцам: X[j][i] — переменная XNames[j] в i-м вычислении. Столбцы x[...]
+// относятся к переменным, f[...] — к целям, остальные — к ограничениям.
+type History struct {
+	Evaluations int
+	XNames      []string
+	FNames      []string
+	GNames      []string
+	X           [][]float64
+	F           [][]float64
+	G           [][]float64
+}
+
+// ParseHistoryCSV разбирает results.csv, записанный run.py. Пустые ячейки
+// становятся NaN.
+func ParseHistoryCSV(r io.Reader) (*History, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения заголовка: %v", err)
+	}
+	h := &History{XNames: []string{}, FNames: []string{}, GNames: []string{}}
+	values := make([][]float64, len(header))
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки %d: %v", h.Evaluations+2, err)
+		}
+		for i, cell := range record {
+			v := math.NaN()
+			if cell = strings.TrimSpace(cell); cell != "" {
+				if v, err = strconv.ParseFloat(cell, 64); err != nil {
+					return nil, fmt.Errorf("строка %d, столбец %s: %v", h.Evaluations+2, header[i], err)
+				}
+			}
+			values[i] = append(values[i], v)
+		}
+		h.Evaluations++
+	}
+
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		col := values[i]
+		if col == nil {
+			col = []float64{}
+		}
+		switch {
+		case strings.HasPrefix(name, "x["):
+			h.XNames = append(h.XNames, name)
+			h.X = append(h.X, col)
+		case strings.HasPrefix(name, "f["):
+			h.FNames = append(h.FNames, name)
+			h.F = append(h.F, col)
+		default:
+			h.GNames = append(h.GNames, name)
+			h.G = append(h.G, col)
+		}
+	}
+	return h, nil
+}
+
+func insertHistory(tx *sql.Tx, resultID string, h *History) error {
+	_, err := tx.Exec(`
+INSERT INTO optimization_history (result_id, evaluations, x_names, f_names, g_names, x, f, g)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+`, resultID, h.Evaluations, pq.Array(h.XNames), pq.Array(h.FNames), pq.Array(h.GNames),
+		encodeColumns(h.X), encodeColumns(h.F), encodeColumns(h.G))
+	if err != nil {
+		return fmt.Errorf("insert optimization_history: %v", err)
+	}
+	return nil
+}
+
+// encodeColumns записывает столбцы подряд как float64 little-endian.
+func encodeColumns(cols [][]float64) []byte {
+	var n int
+	for _, c := range cols {
+		n += len(c)
+	}
+	buf := make([]byte, 0, 8*n)
+	for _, c := range cols {
+		for _, v := range c {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+	}
+	return buf
+}
+
+func decodeColumns(data []byte, count, rows int) ([][]float64, error) {
+	if len(data) != 8*count*rows {
+		return nil, fmt.Errorf("размер истории %d байт не соответствует %d столбцам по %d значений", len(data), count, rows)
+	}
+	cols := make([][]float64, count)
+	for j := range cols {
+		cols[j] = make([]float64, rows)
+		for i := range cols[j] {
+			off := 8 * (j*rows + i)
+			cols[j][i] = math.Float64frombits(binary.LittleEndian.Uint64(data[off:]))
+		}
+	}
+	return cols, nil
+}
+
+// HistoryRow — одно вычисление; Index начинается с 1, NaN передаётся как null.
+type HistoryRow struct {
+	Index int        `json:"index"`
+	X     []*float64 `json:"x"`
+	F     []*float64 `json:"f"`
+	G     []*float64 `json:"g"`
+}
+
+type HistoryPage struct {
+	ResultID    string       `json:"result_id"`
+	Evaluations int          `json:"evaluations"`
+	XNames      []string     `json:"x_names"`
+	FNames      []string     `json:"f_names"`
+	GNames      []string     `json:"g_names"`
+	Rows        []HistoryRow `json:"rows"`
+}
+
+// GetHistory возвращает вычисления с offset по offset+limit. Если история
+// результата не загружена, возвращается nil.
+func GetHistory(resultID string, offset, limit int) (*HistoryPage, error) {
+	h, err := loadHistory(DB, resultID)
+	if h == nil || err != nil {
+		return nil, err
+	}
+	p := &HistoryPage{ResultID: resultID, Evaluations: h.Evaluations, XNames: h.XNames, FNames: h.FNames, GNames: h.GNames}
+	p.Rows = []HistoryRow{}
+	for i := offset; i < p.Evaluations && i < offset+limit; i++ {
+		p.Rows = append(p.Rows, HistoryRow{
+			Index: i + 1,
+			X:     rowValues(h.X, i),
+			F:     rowValues(h.F, i),
+			G:     rowValues(h.G, i),
+		})
+	}
+	return p, nil
+}
+
+// loadHistory возвращает nil, если история результата не загружена.
+func loadHistory(q queryRower, resultID string) (*History, error) {
+	h := &History{}
+	var x, f, g []byte
+	err := q.QueryRow(`
+SELECT evaluations, x_names, f_names, g_names, x, f, g
+FROM optimization_history WHERE result_id = $1
+`, resultID).Scan(&h.Evaluations, pq.Array(&h.XNames), pq.Array(&h.FNames), pq.Array(&h.GNames), &x, &f, &g)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения истории %s: %v", resultID, err)
+	}
+	if h.X, err = decodeColumns(x, len(h.XNames), h.Evaluations); err != nil {
+		return nil, err
+	}
+	if h.F, err = decodeColumns(f, len(h.FNames), h.Evaluations); err != nil {
+		return nil, err
+	}
+	if h.G, err = decodeColumns(g, len(h.GNames), h.Evaluations); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func rowValues(cols [][]float64, i int) []*float64 {
+	out := make([]*float64, len(cols))
+	for j, c := range cols {
+		out[j] = finite(c[i])
+	}
+	return out
+}
+
+// finite возвращает nil для NaN и бесконечностей, которые нельзя передать в JSON.
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// GetObjectiveHistories возвращает значения первой цели по вычислениям для
+// каждого результата из resultIDs, у которого загружена история. Недопустимые
+// вычисления заменяются на NaN, чтобы кривая сходимости, как и best_result,
+// учитывала только допустимые точки; допуск берётся тот же, с которым выбрана
+// лучшая точка результата.
+func GetObjectiveHistories(resultIDs []string) (map[string][]float64, error) {
+	// Первый столбец f лежит в начале блока, остальные столбцы не читаются.
+	rows, err := DB.Query(`
+SELECT h.result_id, h.evaluations, substring(h.f FROM 1 FOR h.evaluations * 8),
+       cardinality(h.g_names), h.g, r.feasibility_tolerance
+FROM optimization_history h
+JOIN optimization_results r ON r.result_id = h.result_id
+WHERE h.result_id = ANY($1) AND cardinality(h.f_names) > 0
+`, pq.Array(resultIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса истории: %v", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string][]float64, len(resultIDs))
+	for rows.Next() {
+		var id string
+		var n, constraints int
+		var f, g []byte
+		var tol float64
+		if err := rows.Scan(&id, &n, &f, &constraints, &g, &tol); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования истории: %v", err)
+		}
+		fs, err := decodeColumns(f, 1, n)
+		if err != nil {
+			return nil, fmt.Errorf("история %s: %v", id, err)
+		}
+		gs, err := decodeColumns(g, constraints, n)
+		if err != nil {
+			return nil, fmt.Errorf("история %s: %v", id, err)
+		}
+		out[id] = feasibleObjective(fs[0], gs, tol)
+	}
+	return out, rows.Err()
+}
+
+// feasibleObjective возвращает копию f, в которой вычисления, нарушающие
+// ограничения g больше чем на tol, заменены на NaN.
+func feasibleObjective(f []float64, g [][]float64, tol float64) []float64 {
+	out := append([]float64(nil), f...)
+	h := &History{G: g}
+	for i := range out {
+		if feasible, _ := rowFeasibility(h, i, tol); !feasible {
+			out[i] = math.NaN()
+		}
+	}
+	return out
+}
+
+// ConvergenceTrace — лучшее значение первой цели, найденное к каждому из
+// бюджетов Budgets. BestF равен null, пока не найдено ни одного допустимого значения.
+type ConvergenceTrace struct {
+	ResultID    string     `json:"result_id"`
+	Evaluations int        `json:"evaluations"`
+	Budgets     []int      `json:"budgets"`
+	BestF       []*float64 `json:"best_f"`
+}
+
+// Convergence прореживает кривую сходимости f до не более чем points
+// бюджетов, равномерно распределённых по логарифмической или линейной шкале.
+// Последний бюджет всегда равен числу вычислений.
+func Convergence(resultID string, f []float64, points int, logScale bool) ConvergenceTrace {
+	t := ConvergenceTrace{
+		ResultID:    resultID,
+		Evaluations: len(f),
+		Budgets:     budgets(len(f), points, logScale),
+	}
+	t.BestF = make([]*float64, len(t.Budgets))
+	best := math.NaN()
+	i := 0
+	for k, b := range t.Budgets {
+		for ; i < b; i++ {
+			if !math.IsNaN(f[i]) && (math.IsNaN(best) || f[i] < best) {
+				best = f[i]
+			}
+		}
+		t.BestF[k] = finite(best)
+	}
+	return t
+}
+
+func budgets(n, points int, logScale bool) []int {
+	if n == 0 {
+		return []int{}
+	}
+	if points >= n {
+		out := make([]int, n)
+		for i := range out {
+			out[i] = i + 1
+		}
+		return out
+	}
+	if points < 2 {
+		return []int{n}
+	}
+	out := make([]int, 0, points)
+	for i := 0; i < points; i++ {
+		t := float64(i) / float64(points-1)
+		var b int
+		if logScale {
+			b = int(math.Round(math.Pow(float64(n), t)))
+		} else {
+			b = int(math.Round(1 + t*float64(n-1)))
+		}
+		if len(out) == 0 || b > out[len(out)-1] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
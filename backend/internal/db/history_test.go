@@ -0,0 +1,45 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFeasibleObjective(t *testing.T) {
+	f := []float64{1, 0, 3, 2}
+	g := [][]float64{{0, 0.5, 0.1, math.NaN()}}
+	got := feasibleObjective(f, g, 0.1)
+	want := []float64{1, math.NaN(), 3, math.NaN()}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(got[i]) || !math.IsNaN(want[i]) && got[i] != want[i] {
+			t.Errorf("feasibleObjective[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if f[1] != 0 {
+		t.Error("feasibleObjective modified its input")
+	}
+}
+
+func TestConvergenceSkipsInfeasible(t *testing.T) {
+	// Лучшее по f вычисление 1 недопустимо, кривая не должна опускаться до него.
+	f := feasibleObjective([]float64{2, 0, 1}, [][]float64{{0, 1, 0}}, 0)
+	trace := Convergence("r", f, 10, false)
+	want := []float64{2, 2, 1}
+	if len(trace.BestF) != len(want) {
+		t.Fatalf("BestF has %d values, want %d", len(trace.BestF), len(want))
+	}
+	for i, w := range want {
+		if trace.BestF[i] == nil || *trace.BestF[i] != w {
+			t.Errorf("BestF[%d] = %v, want %v", i, trace.BestF[i], w)
+		}
+	}
+}
+
+func TestConvergenceAllInfeasible(t *testing.T) {
+	f := feasibleObjective([]float64{2, 0}, [][]float64{{1, 1}}, 0)
+	for i, v := range Convergence("r", f, 10, false).BestF {
+		if v != nil {
+			t.Errorf("BestF[%d] = %v, want null", i, *v)
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+	JobTimedOut  = "timed_out"
+)
+
+// Приоритеты заданий: одиночные запуски выдаются раньше пакетных.
+const (
+	PriorityBulk        = 0
+	PriorityInteractive = 10
+)
+
+// jobClaimLock сериализует выдачу заданий, чтобы проверка лимита
+// одновременных прогонов и захват задания выполнялись атомарно.
+const jobClaimLock = 7301
+
+type Job struct {
+	ID            int                    `json:"id"`
+	UserID        int                    `json:"user_id,omitempty"`
+	MethodID      int                    `json:"method_id"`
+	Parameters    map[string]interface{} `json:"parameters"`
+	Args          []string               `json:"args"`
+	Status        string                 `json:"status"`
+	Tag           string                 `json:"tag"`
+	ContainerID   string                 `json:"container_id,omitempty"`
+	ContainerName string                 `json:"container_name,omitempty"`
+	ExitCode      *int                   `json:"exit_code,omitempty"`
+	ErrorTail     string                 `json:"error_tail,omitempty"`
+	ResultID      string                 `json:"result_id,omitempty"`
+	WorkerID      int                    `json:"worker_id,omitempty"`
+	BatchID       int                    `json:"batch_id,omitempty"`
+	ExperimentID  int                    `json:"experiment_id,omitempty"`
+	RerunOf       string                 `json:"rerun_of,omitempty"`
+	Priority      int                    `json:"priority"`
+	// Budget — ожидаемое число вычислений; 0, если неизвестно.
+	Budget     int64        `json:"budget,omitempty"`
+	Attempt    int          `json:"attempt"`
+	NotBefore  *time.Time   `json:"not_before,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Events     []JobEvent   `json:"events,omitempty"`
+	Attempts   []JobAttempt `json:"attempts,omitempty"`
+	// QueuePosition (с 1) и EstimatedStart заполняются для заданий в очереди.
+	QueuePosition  *int       `json:"queue_position,omitempty"`
+	EstimatedStart *time.Time `json:"estimated_start,omitempty"`
+	// Rerun заполняется для загруженных повторных прогонов.
+	Rerun *RerunComparison `json:"rerun,omitempty"`
+}
+
+type JobEvent struct {
+	ID        int64     `json:"id"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JobIngested записывается в job_events, когда IngestResultsDir загрузил результат задания.
+const JobIngested = "ingested"
+
+// JobIngestFailed записывается в job_events, когда результат задания не загрузился.
+const JobIngestFailed = "ingest_failed"
+
+const jobColumns = `id, user_id, method_id, parameters, args, status, tag,
+       container_id, container_name, exit_code, error_tail, result_id, worker_id,
+       batch_id, experiment_id, rerun_of, priority, budget, attempt, not_before, created_at, started_at, finished_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func recordJobEvent(ex execer, jobID int, status, message string) error {
+	_, err := ex.Exec(`
+INSERT INTO job_events (job_id, status, message) VALUES ($1, $2, $3)
+`, jobID, status, message)
+	if err != nil {
+		return fmt.Errorf("ошибка записи события задания %d: %v", jobID, err)
+	}
+	return nil
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var j Job
+	var userID sql.NullInt64
+	var rawParams []byte
+	var exitCode sql.NullInt64
+	var resultID, rerunOf sql.NullString
+	var workerID, batchID, experimentID, budget sql.NullInt64
+	var notBefore, startedAt, finishedAt sql.NullTime
+	if err := row.Scan(
+		&j.ID, &userID, &j.MethodID, &rawParams, pq.Array(&j.Args), &j.Status, &j.Tag,
+		&j.ContainerID, &j.ContainerName, &exitCode, &j.ErrorTail, &resultID, &workerID,
+		&batchID, &experimentID, &rerunOf, &j.Priority, &budget, &j.Attempt, &notBefore, &j.CreatedAt, &startedAt, &finishedAt,
+	); err != nil {
+		return nil, err
+	}
+	j.UserID = int(userID.Int64)
+	j.ResultID = resultID.String
+	j.WorkerID = int(workerID.Int64)
+	j.BatchID = int(batchID.Int64)
+	j.ExperimentID = int(experimentID.Int64)
+	j.RerunOf = rerunOf.String
+	j.Budget = budget.Int64
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		j.ExitCode = &code
+	}
+	if err := json.Unmarshal(rawParams, &j.Parameters); err != nil {
+		return nil, fmt.Errorf("ошибка разбора параметров задания %d: %v", j.ID, err)
+	}
+	if notBefore.Valid {
+		j.NotBefore = &notBefore.Time
+	}
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return &j, nil
+}
+
+// InsertJob ставит задание в очередь, если его пропускает квота check.
+func InsertJob(j *Job, check QuotaCheck) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkQuota(tx, j.UserID, check); err != nil {
+		return 0, err
+	}
+	id, err := insertJob(tx, j)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func insertJob(tx *sql.Tx, j *Job) (int, error) {
+	raw, err := json.Marshal(j.Parameters)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сериализации параметров: %v", err)
+	}
+	var userID, batchID, experimentID, rerunOf, budget interface{}
+	if j.UserID > 0 {
+		userID = j.UserID
+	}
+	if j.BatchID > 0 {
+		batchID = j.BatchID
+	}
+	if j.ExperimentID > 0 {
+		experimentID = j.ExperimentID
+	}
+	if j.RerunOf != "" {
+		rerunOf = j.RerunOf
+	}
+	if j.Budget > 0 {
+		budget = j.Budget
+	}
+
+	var id int
+	err = tx.QueryRow(`
+INSERT INTO jobs (user_id, method_id, parameters, args, tag, container_name, batch_id, experiment_id, rerun_of, priority, budget)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING id
+`, userID, j.MethodID, raw, pq.Array(j.Args), j.Tag, j.ContainerName, batchID, experimentID, rerunOf, j.Priority, budget).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка постановки задания в очередь: %v", err)
+	}
+	if err := recordJobEvent(tx, id, JobQueued, ""); err != nil {
+		return 0, err
+	}
+	j.ID = id
+	return id, nil
+}
+
+func GetJobByID(id int) (*Job, error) {
+	j, err := scanJob(DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задания: %v", err)
+	}
+	return j, nil
+}
+
+// GetJobsByUser возвращает задания пользователя, новые первыми.
+// Пустой status означает задания в любом состоянии.
+func GetJobsByUser(userID, limit, offset int, status string) ([]Job, error) {
+	rows, err := DB.Query(`
+SELECT `+jobColumns+` FROM jobs
+WHERE user_id = $1 AND ($2 = '' OR status = $2)
+ORDER BY id DESC
+LIMIT $3 OFFSET $4
+`, userID, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса заданий: %v", err)
+	}
+	defer rows.Close()
+	return scanJobs(rows)
+}
+
+func GetJobEvents(jobID int) ([]JobEvent, error) {
+	rows, err := DB.Query(`
+SELECT id, status, message, created_at FROM job_events
+WHERE job_id = $1
+ORDER BY id
+`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса событий задания: %v", err)
+	}
+	defer rows.Close()
+
+	var events []JobEvent
+	for rows.Next() {
+		var e JobEvent
+		if err := rows.Scan(&e.ID, &e.Status, &e.Message, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования события: %v", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func GetJobByContainerName(name string) (*Job, error) {
+	j, err := scanJob(DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE container_name = $1`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задания: %v", err)
+	}
+	return j, nil
+}
+
+// quotaJoin присоединяет к заданию j квоты его владельца (uq) и группы (gq);
+// ожидает, что users уже присоединена как u.
+const quotaJoin = `LEFT JOIN quotas uq ON uq.user_id = j.user_id
+  LEFT JOIN quotas gq ON gq."group" = CASE WHEN j.user_id IS NULL THEN '` + AnonymousGroup + `' ELSE u."group" END`
+
+// maxConcurrent — действующий лимит одновременных прогонов, 0 без ограничения.
+const maxConcurrent = `COALESCE(NULLIF(uq.max_concurrent, 0), gq.max_concurrent, 0)`
+
+// ClaimJob переводит задание из очереди в running, если у получателя есть
+// свободный слот: workerID — удалённый воркер, получающий задание, 0 для пула
+// бэкенда. maxRunning ограничивает задания этого получателя: для пула —
+// выполняющиеся задания без воркера, для воркера — его собственные.
+// Первыми выдаются задания с большим приоритетом, среди них — задания
+// пользователя с наименьшей долей занятых слотов
+// (выполняющиеся задания, делённые на вес), затем самые старые. Пользователи,
+// исчерпавшие квоту одновременных прогонов, пропускаются. Задания,
+// ожидающие повтора, не выдаются раньше not_before. Задания методов с
+// собственным образом удалённым воркерам не выдаются: образ собран только в
+// Docker бэкенда. Возвращает nil, если брать нечего.
+func ClaimJob(maxRunning, workerID int) (*Job, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, jobClaimLock); err != nil {
+		return nil, fmt.Errorf("ошибка блокировки очереди: %v", err)
+	}
+
+	var worker interface{}
+	if workerID > 0 {
+		worker = workerID
+	}
+
+	if maxRunning > 0 {
+		var running int
+		if err := tx.QueryRow(`
+SELECT count(*) FROM jobs WHERE status = $1 AND worker_id IS NOT DISTINCT FROM $2
+`, JobRunning, worker).Scan(&running); err != nil {
+			return nil, fmt.Errorf("ошибка подсчёта заданий: %v", err)
+		}
+		if running >= maxRunning {
+			return nil, nil
+		}
+	}
+	j, err := scanJob(tx.QueryRow(`
+UPDATE jobs SET status = $1, started_at = now(), worker_id = $3
+WHERE id = (
+  SELECT j.id FROM jobs j
+  LEFT JOIN users u ON u.id = j.user_id
+  LEFT JOIN (
+    SELECT user_id, count(*) AS n FROM jobs WHERE status = $1 GROUP BY user_id
+  ) r ON r.user_id IS NOT DISTINCT FROM j.user_id
+  `+quotaJoin+`
+  WHERE j.status = $2 AND (j.not_before IS NULL OR j.not_before <= now())
+    AND (`+maxConcurrent+` = 0 OR COALESCE(r.n, 0) < `+maxConcurrent+`)
+    AND ($3::integer IS NULL OR NOT EXISTS (
+      SELECT 1 FROM optimization_methods m WHERE m.id = j.method_id AND m.image <> ''
+    ))
+  ORDER BY j.priority DESC, COALESCE(r.n, 0) / COALESCE(u.weight, 1) ASC, j.id
+  LIMIT 1
+  FOR UPDATE OF j SKIP LOCKED
+)
+RETURNING `+jobColumns, JobRunning, JobQueued, worker))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка захвата задания: %v", err)
+	}
+	message := ""
+	if workerID > 0 {
+		message = fmt.Sprintf("воркер %d", workerID)
+	}
+	if err := recordJobEvent(tx, j.ID, JobRunning, message); err != nil {
+		return nil, err
+	}
+	return j, tx.Commit()
+}
+
+// SetJobContainer запоминает контейнер запущенного задания. Возвращает false,
+// если задание успели отменить, пока контейнер запускался.
+func SetJobContainer(id int, containerID string) (bool, error) {
+	res, err := DB.Exec(`
+UPDATE jobs SET container_id = $2 WHERE id = $1 AND status = $3
+`, id, containerID, JobRunning)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления задания %d: %v", id, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// CancelJob отменяет задание из очереди или выполняющееся задание и
+// возвращает состояние, в котором оно было. Пустая строка означает, что
+// задание уже завершилось.
+func CancelJob(id int, message string) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var prev string
+	err = tx.QueryRow(`
+UPDATE jobs j SET status = $2, finished_at = now()
+FROM (SELECT id, status FROM jobs WHERE id = $1 FOR UPDATE) old
+WHERE j.id = old.id AND old.status IN ($3, $4)
+RETURNING old.status
+`, id, JobCancelled, JobQueued, JobRunning).Scan(&prev)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка отмены задания %d: %v", id, err)
+	}
+	if prev == JobRunning {
+		if err := recordJobAttempt(tx, id, JobCancelled); err != nil {
+			return "", err
+		}
+	}
+	if err := recordJobEvent(tx, id, JobCancelled, message); err != nil {
+		return "", err
+	}
+	if err := notifyJob(tx, id, nil); err != nil {
+		return "", err
+	}
+	return prev, tx.Commit()
+}
+
+// FinishJob переводит выполняющееся задание в конечное состояние. exitCode
+// равен nil, если прогон не дошёл до завершения run.py.
+func FinishJob(id int, status string, exitCode *int, errorTail string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var code interface{}
+	message := ""
+	if exitCode != nil {
+		code = *exitCode
+		message = fmt.Sprintf("код выхода %d", *exitCode)
+	}
+	var resultID sql.NullString
+	err = tx.QueryRow(`
+UPDATE jobs SET status = $2, exit_code = $3, error_tail = $4, finished_at = now()
+WHERE id = $1 AND status = $5
+RETURNING result_id
+`, id, status, code, errorTail, JobRunning).Scan(&resultID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка завершения задания %d: %v", id, err)
+	}
+	if err := recordJobAttempt(tx, id, status); err != nil {
+		return err
+	}
+	if err := recordJobEvent(tx, id, status, message); err != nil {
+		return err
+	}
+	// Об успехе сообщается, когда задание и завершилось, и связано с
+	// результатом: здесь, если результат загружен раньше, иначе в LinkJobResult.
+	var payload *WebhookPayload
+	switch {
+	case status != JobSucceeded:
+		payload = &WebhookPayload{Event: EventJobFailed, Error: errorTail}
+	case resultID.Valid:
+		if payload, err = jobSucceededPayload(tx, resultID.String); err != nil {
+			return err
+		}
+	}
+	if err := notifyJob(tx, id, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RequeueJob возвращает выполняющееся задание в очередь: оно было захвачено,
+// но не запущено, либо его воркер пропал.
+func RequeueJob(id int, reason string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+UPDATE jobs SET status = $2, started_at = NULL, container_id = '', worker_id = NULL
+WHERE id = $1 AND status = $3
+`, id, JobQueued, JobRunning)
+	if err != nil {
+		return fmt.Errorf("ошибка возврата задания %d в очередь: %v", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if err := recordJobEvent(tx, id, JobQueued, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LinkJobResult связывает задание с загруженным результатом и, если задание
+// поставлено в эксперимент, привязывает результат к нему. Папка результата
+// называется тегом задания, поэтому result_id совпадает с tag.
+func LinkJobResult(resultID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var jobID int
+	var status string
+	err = tx.QueryRow(`
+UPDATE jobs SET result_id = $1 WHERE tag = $1 RETURNING id, status
+`, resultID).Scan(&jobID, &status)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка связывания результата %s: %v", resultID, err)
+	}
+	_, err = tx.Exec(`
+INSERT INTO experiment_results (experiment_id, result_id)
+SELECT experiment_id, $2 FROM jobs WHERE id = $1 AND experiment_id IS NOT NULL
+ON CONFLICT DO NOTHING
+`, jobID, resultID)
+	if err != nil {
+		return fmt.Errorf("ошибка привязки результата %s к эксперименту: %v", resultID, err)
+	}
+	if err := recordJobEvent(tx, jobID, JobIngested, resultID); err != nil {
+		return err
+	}
+	// run.py переименовывает results.json до выхода процесса, поэтому задание
+	// обычно ещё выполняется: тогда job.succeeded отправит FinishJob.
+	var payload *WebhookPayload
+	if status == JobSucceeded {
+		if payload, err = jobSucceededPayload(tx, resultID); err != nil {
+			return err
+		}
+	}
+	if err := notifyJob(tx, jobID, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func jobSucceededPayload(tx *sql.Tx, resultID string) (*WebhookPayload, error) {
+	var bestF float64
+	err := tx.QueryRow(`SELECT best_result_f FROM optimization_results WHERE result_id = $1`, resultID).Scan(&bestF)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения результата %s: %v", resultID, err)
+	}
+	return &WebhookPayload{Event: EventJobSucceeded, ResultID: resultID, BestF: &bestF}, nil
+}
+
+func GetJobsByStatus(status string) ([]Job, error) {
+	rows, err := DB.Query(`SELECT `+jobColumns+` FROM jobs WHERE status = $1 ORDER BY id`, status)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса заданий: %v", err)
+	}
+	defer rows.Close()
+	return scanJobs(rows)
+}
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	var jobs []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования задания: %v", err)
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
@@ -3,6 +3,9 @@ package db
 import (
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type OptimizationMethodParam struct {
@@ -11,15 +14,108 @@ type OptimizationMethodParam struct {
 	Nullable bool        `json:"nullable,omitempty"`
 }
 
+// ResourceLimits ограничивает один прогон. Нулевое поле означает отсутствие ограничения.
+type ResourceLimits struct {
+	CPUs           float64 `json:"cpus,omitempty"`
+	MemoryMB       int     `json:"memory_mb,omitempty"`
+	TimeoutSeconds int     `json:"timeout_seconds,omitempty"`
+}
+
+// Merge возвращает лимиты, в которых заданные поля override заменяют текущие.
+func (l ResourceLimits) Merge(override ResourceLimits) ResourceLimits {
+	if override.CPUs > 0 {
+		l.CPUs = override.CPUs
+	}
+	if override.MemoryMB > 0 {
+		l.MemoryMB = override.MemoryMB
+	}
+	if override.TimeoutSeconds > 0 {
+		l.TimeoutSeconds = override.TimeoutSeconds
+	}
+	return l
+}
+
+// RetryPolicy задаёт повторы прогонов, упавших по временной причине.
+// MaxAttempts учитывает первую попытку: 0 и 1 отключают повторы.
+type RetryPolicy struct {
+	MaxAttempts       int `json:"max_attempts,omitempty"`
+	BackoffSeconds    int `json:"backoff_seconds,omitempty"`
+	MaxBackoffSeconds int `json:"max_backoff_seconds,omitempty"`
+}
+
+const (
+	defaultBackoffSeconds    = 10
+	defaultMaxBackoffSeconds = 600
+)
+
+// Merge возвращает политику, в которой заданные поля override заменяют текущие.
+func (p RetryPolicy) Merge(override RetryPolicy) RetryPolicy {
+	if override.MaxAttempts > 0 {
+		p.MaxAttempts = override.MaxAttempts
+	}
+	if override.BackoffSeconds > 0 {
+		p.BackoffSeconds = override.BackoffSeconds
+	}
+	if override.MaxBackoffSeconds > 0 {
+		p.MaxBackoffSeconds = override.MaxBackoffSeconds
+	}
+	return p
+}
+
+// Backoff возвращает задержку перед попыткой attempt+1: BackoffSeconds,
+// удваивающиеся с каждой попыткой, но не больше MaxBackoffSeconds.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	base := p.BackoffSeconds
+	if base <= 0 {
+		base = defaultBackoffSeconds
+	}
+	limit := p.MaxBackoffSeconds
+	if limit <= 0 {
+		limit = defaultMaxBackoffSeconds
+	}
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return time.Duration(delay) * time.Second
+}
+
 type OptimizationMethod struct {
 	ID         int                                `json:"id"`
 	Name       string                             `json:"name"`
 	Parameters map[string]OptimizationMethodParam `json:"parameters"`
 	FilePath   string                             `json:"file_path"`
+	Limits     ResourceLimits                     `json:"limits"`
+	Retry      RetryPolicy                        `json:"retry_policy"`
+	// Image — собранный образ метода; пустой — прогоны идут в образе по умолчанию.
+	Image string `json:"image,omitempty"`
+}
+
+const methodColumns = `id, name, parameters, file_path, limits, retry_policy, image`
+
+func scanMethod(row rowScanner) (*OptimizationMethod, error) {
+	var m OptimizationMethod
+	var raw, rawLimits, rawRetry []byte
+	if err := row.Scan(&m.ID, &m.Name, &raw, &m.FilePath, &rawLimits, &rawRetry, &m.Image); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &m.Parameters); err != nil {
+		return nil, fmt.Errorf("ошибка разбора JSON параметров: %v", err)
+	}
+	if err := json.Unmarshal(rawLimits, &m.Limits); err != nil {
+		return nil, fmt.Errorf("ошибка разбора JSON лимитов: %v", err)
+	}
+	if err := json.Unmarshal(rawRetry, &m.Retry); err != nil {
+		return nil, fmt.Errorf("ошибка разбора JSON политики повторов: %v", err)
+	}
+	return &m, nil
 }
 
 func GetAllOptimizationMethods() ([]OptimizationMethod, error) {
-	rows, err := DB.Query(`SELECT id, name, parameters, file_path FROM optimization_methods`)
+	rows, err := DB.Query(`SELECT ` + methodColumns + ` FROM optimization_methods`)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса методов: %v", err)
 	}
@@ -27,47 +123,49 @@ func GetAllOptimizationMethods() ([]OptimizationMethod, error) {
 
 	var methods []OptimizationMethod
 	for rows.Next() {
-		var m OptimizationMethod
-		var raw []byte
-		if err := rows.Scan(&m.ID, &m.Name, &raw, &m.FilePath); err != nil {
+		m, err := scanMethod(rows)
+		if err != nil {
 			return nil, fmt.Errorf("ошибка сканирования метода: %v", err)
 		}
-		if err := json.Unmarshal(raw, &m.Parameters); err != nil {
-			return nil, fmt.Errorf("ошибка разбора JSON параметров: %v", err)
-		}
-		methods = append(methods, m)
+		methods = append(methods, *m)
 	}
 	return methods, nil
 }
 
 func GetOptimizationMethodByID(id int) (*OptimizationMethod, error) {
-	row := DB.QueryRow(`SELECT id, name, parameters, file_path FROM optimization_methods WHERE id=$1`, id)
-	var m OptimizationMethod
-	var raw []byte
-	if err := row.Scan(&m.ID, &m.Name, &raw, &m.FilePath); err != nil {
-		return nil, fmt.Errorf("ошибка получения метода: %v", err)
-	}
-	if err := json.Unmarshal(raw, &m.Parameters); err != nil {
-		return nil, fmt.Errorf("ошибка разбора JSON параметров: %v", err)
+	m, err := scanMethod(DB.QueryRow(`SELECT `+methodColumns+` FROM optimization_methods WHERE id=$1`, id))
+	if err != nil {
+		// %w: вызывающие отличают отсутствующий метод по sql.ErrNoRows.
+		return nil, fmt.Errorf("ошибка получения метода: %w", err)
 	}
-	return &m, nil
+	return m, nil
 }
 
 func InsertOptimizationMethod(
 	name string,
 	params map[string]OptimizationMethodParam,
 	filePath string,
+	limits ResourceLimits,
+	retry RetryPolicy,
 ) (int, error) {
 	raw, err := json.Marshal(params)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка сериализации параметров: %v", err)
 	}
+	rawLimits, err := json.Marshal(limits)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сериализации лимитов: %v", err)
+	}
+	rawRetry, err := json.Marshal(retry)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сериализации политики повторов: %v", err)
+	}
 	var id int
 	err = DB.QueryRow(`
-        INSERT INTO optimization_methods (name, parameters, file_path)
-        VALUES ($1, $2, $3)
+        INSERT INTO optimization_methods (name, parameters, file_path, limits, retry_policy)
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id
-    `, name, raw, filePath).Scan(&id)
+    `, name, raw, filePath, rawLimits, rawRetry).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка вставки метода: %v", err)
 	}
@@ -81,3 +179,45 @@ func DeleteOptimizationMethodByID(id int) error {
 	}
 	return nil
 }
+
+func UpdateOptimizationMethodLimits(id int, limits ResourceLimits) error {
+	raw, err := json.Marshal(limits)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации лимитов: %v", err)
+	}
+	_, err = DB.Exec(`UPDATE optimization_methods SET limits = $2 WHERE id = $1`, id, raw)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления лимитов метода: %v", err)
+	}
+	return nil
+}
+
+func UpdateOptimizationMethodRetryPolicy(id int, retry RetryPolicy) error {
+	raw, err := json.Marshal(retry)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации политики повторов: %v", err)
+	}
+	_, err = DB.Exec(`UPDATE optimization_methods SET retry_policy = $2 WHERE id = $1`, id, raw)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления политики повторов метода: %v", err)
+	}
+	return nil
+}
+
+func UpdateOptimizationMethodImage(id int, image string) error {
+	_, err := DB.Exec(`UPDATE optimization_methods SET image = $2 WHERE id = $1`, id, image)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления образа метода: %v", err)
+	}
+	return nil
+}
+
+// ClearOptimizationMethodImages возвращает образ по умолчанию методам,
+// использовавшим один из удалённых образов.
+func ClearOptimizationMethodImages(images []string) error {
+	_, err := DB.Exec(`UPDATE optimization_methods SET image = '' WHERE image = ANY($1)`, pq.Array(images))
+	if err != nil {
+		return fmt.Errorf("ошибка обновления образа метода: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"defaults first attempt", RetryPolicy{}, 1, 10 * time.Second},
+		{"defaults doubling", RetryPolicy{}, 3, 40 * time.Second},
+		{"defaults cap", RetryPolicy{}, 20, 600 * time.Second},
+		{"attempt zero", RetryPolicy{BackoffSeconds: 5}, 0, 5 * time.Second},
+		{"custom base", RetryPolicy{BackoffSeconds: 5, MaxBackoffSeconds: 100}, 4, 40 * time.Second},
+		{"custom cap", RetryPolicy{BackoffSeconds: 5, MaxBackoffSeconds: 100}, 6, 100 * time.Second},
+		{"cap below base", RetryPolicy{BackoffSeconds: 30, MaxBackoffSeconds: 20}, 1, 20 * time.Second},
+		{"large attempt does not overflow", RetryPolicy{BackoffSeconds: 1, MaxBackoffSeconds: 3600}, 1000, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyMerge(t *testing.T) {
+	base := RetryPolicy{MaxAttempts: 3, BackoffSeconds: 10, MaxBackoffSeconds: 600}
+	got := base.Merge(RetryPolicy{MaxAttempts: 5})
+	want := RetryPolicy{MaxAttempts: 5, BackoffSeconds: 10, MaxBackoffSeconds: 600}
+	if got != want {
+		t.Errorf("Merge = %+v, want %+v", got, want)
+	}
+	if got := base.Merge(RetryPolicy{}); got != base {
+		t.Errorf("Merge with empty override = %+v, want %+v", got, base)
+	}
+}
@@ -0,0 +1,257 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// ParetoPoint — недоминируемое вычисление из истории; Evaluation начинается с 1.
+type ParetoPoint struct {
+	Evaluation int       `json:"evaluation"`
+	X          []float64 `json:"x"`
+	F          []float64 `json:"f"`
+}
+
+// ParetoFront — фронт Парето результата при минимизации всех целей.
+// Hypervolume заполняется, если задана опорная точка.
+type ParetoFront struct {
+	ResultID       string        `json:"result_id"`
+	ObjectiveNames []string      `json:"objective_names"`
+	Points         []ParetoPoint `json:"points"`
+	Hypervolume    *float64      `json:"hypervolume,omitempty"`
+}
+
+// Objectives возвращает значения целей точек фронта.
+func (p *ParetoFront) Objectives() [][]float64 {
+	fs := make([][]float64, len(p.Points))
+	for i, pt := range p.Points {
+		fs[i] = pt.F
+	}
+	return fs
+}
+
+// paretoFront возвращает номера недоминируемых допустимых вычислений истории
+// (с 0). Вычисления с пропущенными или бесконечными значениями не учитываются,
+// из совпадающих точек остаётся первая.
+func paretoFront(h *History, tol float64) []int {
+	if len(h.F) == 0 {
+		return nil
+	}
+	var candidates []int
+	for i := 0; i < h.Evaluations; i++ {
+		if !rowFinite(h.F, i) || !rowFinite(h.X, i) {
+			continue
+		}
+		if feasible, _ := rowFeasibility(h, i, tol); feasible {
+			candidates = append(candidates, i)
+		}
+	}
+	// После лексикографической сортировки точку может доминировать только
+	// точка, стоящая раньше, поэтому её достаточно сравнить с уже найденным фронтом.
+	sort.SliceStable(candidates, func(a, b int) bool {
+		for _, col := range h.F {
+			if col[candidates[a]] != col[candidates[b]] {
+				return col[candidates[a]] < col[candidates[b]]
+			}
+		}
+		return false
+	})
+	var front []int
+	for _, i := range candidates {
+		dominated := false
+		for _, j := range front {
+			if weaklyDominates(h.F, j, i) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			front = append(front, i)
+		}
+	}
+	sort.Ints(front)
+	return front
+}
+
+func rowFinite(cols [][]float64, i int) bool {
+	for _, c := range cols {
+		if math.IsNaN(c[i]) || math.IsInf(c[i], 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// weaklyDominates сообщает, что вычисление a не хуже b по всем целям.
+func weaklyDominates(cols [][]float64, a, b int) bool {
+	for _, c := range cols {
+		if c[a] > c[b] {
+			return false
+		}
+	}
+	return true
+}
+
+func insertParetoFront(tx *sql.Tx, resultID string, h *History, tol float64) error {
+	for _, i := range paretoFront(h, tol) {
+		x := make([]float64, len(h.X))
+		for j, c := range h.X {
+			x[j] = c[i]
+		}
+		f := make([]float64, len(h.F))
+		for j, c := range h.F {
+			f[j] = c[i]
+		}
+		if _, err := tx.Exec(`
+INSERT INTO pareto_points (result_id, evaluation, x, f) VALUES ($1, $2, $3, $4)
+`, resultID, i+1, pq.Array(x), pq.Array(f)); err != nil {
+			return fmt.Errorf("insert pareto_points: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetParetoFront возвращает nil, если история результата не загружена.
+func GetParetoFront(resultID string) (*ParetoFront, error) {
+	fronts, err := GetParetoFronts([]string{resultID})
+	if err != nil {
+		return nil, err
+	}
+	return fronts[resultID], nil
+}
+
+// GetParetoFronts возвращает фронты результатов из resultIDs, у которых загружена история.
+func GetParetoFronts(resultIDs []string) (map[string]*ParetoFront, error) {
+	fronts := make(map[string]*ParetoFront, len(resultIDs))
+	rows, err := DB.Query(`
+SELECT result_id, f_names FROM optimization_history WHERE result_id = ANY($1)
+`, pq.Array(resultIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса фронтов Парето: %v", err)
+	}
+	for rows.Next() {
+		p := &ParetoFront{Points: []ParetoPoint{}}
+		if err := rows.Scan(&p.ResultID, pq.Array(&p.ObjectiveNames)); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка сканирования фронта Парето: %v", err)
+		}
+		fronts[p.ResultID] = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = DB.Query(`
+SELECT result_id, evaluation, x, f FROM pareto_points
+WHERE result_id = ANY($1)
+ORDER BY result_id, evaluation
+`, pq.Array(resultIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса фронтов Парето: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var pt ParetoPoint
+		if err := rows.Scan(&id, &pt.Evaluation, pq.Array(&pt.X), pq.Array(&pt.F)); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования точки фронта: %v", err)
+		}
+		if p, ok := fronts[id]; ok {
+			p.Points = append(p.Points, pt)
+		}
+	}
+	return fronts, rows.Err()
+}
+
+// Hypervolume возвращает объём области, которую точки доминируют и которая
+// ограничена опорной точкой ref, при минимизации всех целей. Точки, не лучшие
+// ref по каждой цели, не вносят вклада. В худшем случае время растёт как
+// n^(d-1), поэтому вызывающие ограничивают число целей и размер фронтов.
+func Hypervolume(points [][]float64, ref []float64) float64 {
+	var inside [][]float64
+	for _, p := range points {
+		ok := len(p) == len(ref)
+		for j := 0; ok && j < len(ref); j++ {
+			ok = p[j] < ref[j]
+		}
+		if ok {
+			inside = append(inside, p)
+		}
+	}
+	return hypervolume(inside, ref, len(ref))
+}
+
+// hypervolume считает объём по первым d целям, разрезая область на слои по последней из них.
+func hypervolume(points [][]float64, ref []float64, d int) float64 {
+	if len(points) == 0 || d == 0 {
+		return 0
+	}
+	if d == 1 {
+		best := ref[0]
+		for _, p := range points {
+			best = math.Min(best, p[0])
+		}
+		return ref[0] - best
+	}
+	points = append([][]float64(nil), points...)
+	if d == 2 {
+		sort.Slice(points, func(a, b int) bool { return points[a][0] < points[b][0] })
+		var volume float64
+		top := ref[1]
+		for _, p := range points {
+			if p[1] < top {
+				volume += (ref[0] - p[0]) * (top - p[1])
+				top = p[1]
+			}
+		}
+		return volume
+	}
+	sort.Slice(points, func(a, b int) bool { return points[a][d-1] < points[b][d-1] })
+	var volume float64
+	// front — точки слоя, недоминируемые по первым d-1 целям: остальные
+	// не меняют объём слоя, но умножали бы работу рекурсии.
+	var front [][]float64
+	for i, p := range points {
+		front = addNondominated(front, p, d-1)
+		next := ref[d-1]
+		if i+1 < len(points) {
+			next = points[i+1][d-1]
+		}
+		if next > p[d-1] {
+			volume += hypervolume(front, ref, d-1) * (next - p[d-1])
+		}
+	}
+	return volume
+}
+
+// addNondominated добавляет p во front, если его не доминирует ни одна точка
+// front по первым d целям, и убирает точки, которые доминирует p.
+func addNondominated(front [][]float64, p []float64, d int) [][]float64 {
+	for _, q := range front {
+		if dominatesIn(q, p, d) {
+			return front
+		}
+	}
+	kept := front[:0]
+	for _, q := range front {
+		if !dominatesIn(p, q, d) {
+			kept = append(kept, q)
+		}
+	}
+	return append(kept, p)
+}
+
+// dominatesIn сообщает, что a не хуже b по первым d целям.
+func dominatesIn(a, b []float64, d int) bool {
+	for j := 0; j < d; j++ {
+		if a[j] > b[j] {
+			return false
+		}
+	}
+	return true
+}
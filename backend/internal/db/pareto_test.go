@@ -0,0 +1,134 @@
+package db
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// newHistory собирает историю из построчных значений x, f и g; g может быть nil.
+func newHistory(x, f, g [][]float64) *History {
+	h := &History{Evaluations: len(f)}
+	h.X = columns(x)
+	h.F = columns(f)
+	h.G = columns(g)
+	return h
+}
+
+func columns(rows [][]float64) [][]float64 {
+	if len(rows) == 0 {
+		return nil
+	}
+	cols := make([][]float64, len(rows[0]))
+	for j := range cols {
+		cols[j] = make([]float64, len(rows))
+		for i, row := range rows {
+			cols[j][i] = row[j]
+		}
+	}
+	return cols
+}
+
+// xs возвращает по одной переменной на каждое из n вычислений.
+func xs(n int) [][]float64 {
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = []float64{float64(i)}
+	}
+	return rows
+}
+
+func TestParetoFront(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name string
+		f    [][]float64
+		g    [][]float64
+		tol  float64
+		want []int
+	}{
+		{"dominated point dropped", [][]float64{{1, 3}, {2, 2}, {3, 3}, {3, 1}}, nil, 0, []int{0, 1, 3}},
+		{"weakly dominated point dropped", [][]float64{{1, 3}, {1, 2}}, nil, 0, []int{1}},
+		{"duplicates keep first", [][]float64{{2, 0}, {1, 1}, {1, 1}}, nil, 0, []int{0, 1}},
+		{"all duplicates", [][]float64{{1, 1}, {1, 1}, {1, 1}}, nil, 0, []int{0}},
+		{"single objective", [][]float64{{3}, {1}, {2}, {1}}, nil, 0, []int{1}},
+		{"non-finite objectives skipped", [][]float64{{nan, 0}, {math.Inf(-1), 5}, {1, 1}}, nil, 0, []int{2}},
+		{"infeasible dominating point skipped", [][]float64{{1, 1}, {2, 2}}, [][]float64{{0.5}, {0}}, 0, []int{1}},
+		{"violation within tolerance", [][]float64{{1, 1}, {2, 2}}, [][]float64{{0.5}, {0}}, 0.5, []int{0}},
+		{"NaN constraint is infeasible", [][]float64{{1, 1}, {2, 2}}, [][]float64{{nan}, {-1}}, 1, []int{1}},
+		{"nothing feasible", [][]float64{{1, 1}, {2, 2}}, [][]float64{{1}, {2}}, 0, nil},
+		{"no objectives", nil, nil, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(xs(len(tt.f)), tt.f, tt.g)
+			if got := paretoFront(h, tt.tol); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paretoFront = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParetoFrontSkipsNonFiniteX(t *testing.T) {
+	h := newHistory([][]float64{{math.Inf(1)}, {0}}, [][]float64{{0, 0}, {1, 1}}, nil)
+	if got, want := paretoFront(h, 0), []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paretoFront = %v, want %v", got, want)
+	}
+}
+
+func TestHypervolume(t *testing.T) {
+	staircase := [][]float64{{1, 3}, {2, 2}, {3, 1}}
+	corners := [][]float64{{0, 1, 1}, {1, 0, 1}, {1, 1, 0}}
+	tests := []struct {
+		name   string
+		points [][]float64
+		ref    []float64
+		want   float64
+	}{
+		{"empty", nil, []float64{1, 1}, 0},
+		{"1-D", [][]float64{{2}, {1}}, []float64{5}, 4},
+		{"2-D single point", [][]float64{{1, 1}}, []float64{3, 2}, 2},
+		// Ступени 3×1 + 2×1 + 1×1.
+		{"2-D staircase", staircase, []float64{4, 4}, 6},
+		{"2-D unsorted", [][]float64{{3, 1}, {1, 3}, {2, 2}}, []float64{4, 4}, 6},
+		{"2-D dominated point", append([][]float64{{3, 3}, {2.5, 2.5}}, staircase...), []float64{4, 4}, 6},
+		{"2-D duplicates", append([][]float64{{2, 2}, {1, 3}}, staircase...), []float64{4, 4}, 6},
+		{"2-D points outside reference", append([][]float64{{5, 0}, {4, 0}, {0, 4}}, staircase...), []float64{4, 4}, 6},
+		{"2-D wrong dimension ignored", append([][]float64{{0, 0, 0}}, staircase...), []float64{4, 4}, 6},
+		{"3-D single point", [][]float64{{1, 1, 1}}, []float64{2, 2, 2}, 1},
+		// Коробки 2×2×1 и 1×1×2 пересекаются по кубу 1×1×1: 4 + 2 − 1.
+		{"3-D two points", [][]float64{{0, 0, 1}, {1, 1, 0}}, []float64{2, 2, 2}, 5},
+		// Три коробки по 2, попарные и тройное пересечения — один и тот же единичный куб: 6 − 3 + 1.
+		{"3-D corners", corners, []float64{2, 2, 2}, 4},
+		{"3-D dominated point", append([][]float64{{1.5, 1.5, 1.5}}, corners...), []float64{2, 2, 2}, 4},
+		{"3-D duplicates", append([][]float64{{1, 0, 1}, {0, 1, 1}}, corners...), []float64{2, 2, 2}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hypervolume(tt.points, tt.ref); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Hypervolume = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHypervolumeIgnoresPointsDominatedInSlices(t *testing.T) {
+	// Точки, доминируемые по первым двум целям более ранним слоем, не меняют объём.
+	points := [][]float64{{0, 1, 1}, {1, 0, 1}, {1, 1, 0}}
+	for i := 0; i < 200; i++ {
+		v := 1 + float64(i)/400
+		points = append(points, []float64{v, v, 0.5 + float64(i)/400})
+	}
+	if got := Hypervolume(points, []float64{2, 2, 2}); math.Abs(got-4) > 1e-12 {
+		t.Errorf("Hypervolume = %v, want 4", got)
+	}
+}
+
+func TestHypervolumeDoesNotReorderInput(t *testing.T) {
+	points := [][]float64{{3, 1}, {1, 3}, {2, 2}}
+	want := [][]float64{{3, 1}, {1, 3}, {2, 2}}
+	Hypervolume(points, []float64{4, 4})
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("Hypervolume reordered its input: %v", points)
+	}
+}
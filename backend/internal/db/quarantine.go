@@ -0,0 +1,130 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrIngestFailed оборачивает сообщение об ошибке загрузки папки результатов.
+var ErrIngestFailed = errors.New("ingestion failed")
+
+// IngestFailure — папка результатов в карантине: <result_id>.failed и
+// последняя ошибка её загрузки. Задание заполняется, если папку создал запуск из очереди.
+type IngestFailure struct {
+	ResultID      string    `json:"result_id"`
+	Error         string    `json:"error"`
+	Attempts      int       `json:"attempts"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	FailedAt      time.Time `json:"failed_at"`
+	JobID         int       `json:"job_id,omitempty"`
+	UserID        int       `json:"user_id,omitempty"`
+	MethodID      int       `json:"method_id,omitempty"`
+}
+
+const ingestFailureColumns = `
+f.result_id, f.error, f.attempts, f.first_failed_at, f.failed_at, j.id, j.user_id, j.method_id
+FROM ingest_failures f
+LEFT JOIN jobs j ON j.tag = f.result_id`
+
+func scanIngestFailure(row rowScanner) (IngestFailure, error) {
+	var f IngestFailure
+	var jobID, userID, methodID sql.NullInt64
+	err := row.Scan(&f.ResultID, &f.Error, &f.Attempts, &f.FirstFailedAt, &f.FailedAt, &jobID, &userID, &methodID)
+	f.JobID = int(jobID.Int64)
+	f.UserID = int(userID.Int64)
+	f.MethodID = int(methodID.Int64)
+	return f, err
+}
+
+// upsertQuarantine записывает ошибку загрузки папки resultID в карантин.
+// События задания пишет RecordIngestFailure.
+func upsertQuarantine(resultID, message string) error {
+	_, err := DB.Exec(`
+INSERT INTO ingest_failures (result_id, error) VALUES ($1, $2)
+ON CONFLICT (result_id) DO UPDATE
+  SET error = EXCLUDED.error, attempts = ingest_failures.attempts + 1, failed_at = now()
+`, resultID, message)
+	if err != nil {
+		return fmt.Errorf("ошибка записи карантина %s: %v", resultID, err)
+	}
+	return nil
+}
+
+func clearIngestFailure(resultID string) error {
+	if _, err := DB.Exec(`DELETE FROM ingest_failures WHERE result_id = $1`, resultID); err != nil {
+		return fmt.Errorf("ошибка удаления %s из карантина: %v", resultID, err)
+	}
+	return nil
+}
+
+// GetIngestFailures возвращает папки в карантине, последние ошибки первыми.
+func GetIngestFailures(limit, offset int) ([]IngestFailure, error) {
+	rows, err := DB.Query(`SELECT `+ingestFailureColumns+`
+ORDER BY f.failed_at DESC, f.result_id
+LIMIT $1 OFFSET $2
+`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса карантина: %v", err)
+	}
+	defer rows.Close()
+
+	list := []IngestFailure{}
+	for rows.Next() {
+		f, err := scanIngestFailure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования карантина: %v", err)
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+// GetIngestFailure возвращает nil, если папки resultID нет в карантине.
+func GetIngestFailure(resultID string) (*IngestFailure, error) {
+	f, err := scanIngestFailure(DB.QueryRow(`SELECT `+ingestFailureColumns+`
+WHERE f.result_id = $1
+`, resultID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения %s из карантина: %v", resultID, err)
+	}
+	return &f, nil
+}
+
+// RetryIngestFailure возвращает папку из карантина и сразу загружает её.
+// Если загрузка снова не удалась, папка возвращается в карантин, а ошибка
+// оборачивает ErrIngestFailed.
+func RetryIngestFailure(resultsDir, resultID string) error {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	dir := filepath.Join(resultsDir, resultID)
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("папка %s уже существует", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir+FailedSuffix, ResultsFile)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: в папке нет %s", ErrIngestFailed, ResultsFile)
+	}
+	if err := os.Rename(dir+FailedSuffix, dir); err != nil {
+		return fmt.Errorf("ошибка возврата папки %s из карантина: %v", dir, err)
+	}
+	return ingestDir(dir)
+}
+
+// DiscardIngestFailure удаляет папку из карантина вместе с файлами.
+func DiscardIngestFailure(resultsDir, resultID string) error {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	dir := filepath.Join(resultsDir, resultID) + FailedSuffix
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("ошибка удаления папки %s: %v", dir, err)
+	}
+	return clearIngestFailure(resultID)
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type queuedJob struct {
+	id       int
+	userID   int
+	priority int
+}
+
+// QueueOrder возвращает ID заданий в очереди в том порядке, в котором их
+// выдаст ClaimJob, если ни одно выполняющееся задание не завершится, и число
+// выполняющихся заданий. Ожидание повтора (not_before) не учитывается, а
+// упёршиеся в квоту пользователи ждут, пока не освободятся все слоты.
+func QueueOrder() ([]int, int, error) {
+	running := make(map[int]int)
+	weights := make(map[int]float64)
+	caps := make(map[int]int)
+	rows, err := DB.Query(`
+SELECT COALESCE(j.user_id, 0), j.status, count(*), COALESCE(MAX(u.weight), 1), MAX(`+maxConcurrent+`)
+FROM jobs j
+LEFT JOIN users u ON u.id = j.user_id
+`+quotaJoin+`
+WHERE j.status IN ($1, $2)
+GROUP BY j.user_id, j.status
+`, JobQueued, JobRunning)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка получения очереди: %v", err)
+	}
+	total := 0
+	for rows.Next() {
+		var userID, n, limit int
+		var status string
+		var weight float64
+		if err := rows.Scan(&userID, &status, &n, &weight, &limit); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("ошибка чтения очереди: %v", err)
+		}
+		weights[userID] = weight
+		caps[userID] = limit
+		if status == JobRunning {
+			running[userID] = n
+			total += n
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка чтения очереди: %v", err)
+	}
+
+	rows, err = DB.Query(`
+SELECT id, COALESCE(user_id, 0), priority FROM jobs WHERE status = $1 ORDER BY priority DESC, id
+`, JobQueued)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка получения очереди: %v", err)
+	}
+	defer rows.Close()
+	// Очереди пользователей уже упорядочены по приоритету и возрасту.
+	queues := make(map[int][]queuedJob)
+	var users []int
+	n := 0
+	for rows.Next() {
+		var q queuedJob
+		if err := rows.Scan(&q.id, &q.userID, &q.priority); err != nil {
+			return nil, 0, fmt.Errorf("ошибка чтения очереди: %v", err)
+		}
+		if _, ok := queues[q.userID]; !ok {
+			users = append(users, q.userID)
+		}
+		queues[q.userID] = append(queues[q.userID], q)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка чтения очереди: %v", err)
+	}
+	sort.Ints(users)
+
+	order := make([]int, 0, n)
+	for len(order) < n {
+		best := -1
+		var bestJob queuedJob
+		var bestShare float64
+		for _, u := range users {
+			if len(queues[u]) == 0 {
+				continue
+			}
+			if caps[u] > 0 && running[u] >= caps[u] {
+				continue
+			}
+			head := queues[u][0]
+			share := float64(running[u]) / weights[u]
+			if best < 0 || head.priority > bestJob.priority ||
+				head.priority == bestJob.priority && (share < bestShare || share == bestShare && head.id < bestJob.id) {
+				best, bestJob, bestShare = u, head, share
+			}
+		}
+		if best < 0 {
+			// Все оставшиеся упёрлись в квоту: считаем, что их прогоны завершились.
+			for u := range running {
+				running[u] = 0
+			}
+			continue
+		}
+		order = append(order, bestJob.id)
+		queues[best] = queues[best][1:]
+		running[best]++
+	}
+	return order, total, nil
+}
+
+// AverageRunDuration возвращает среднюю длительность последних успешных
+// прогонов или 0, если их ещё не было.
+func AverageRunDuration() (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := DB.QueryRow(`
+SELECT avg(extract(epoch FROM finished_at - started_at)) FROM (
+  SELECT started_at, finished_at FROM jobs
+  WHERE status = $1 AND started_at IS NOT NULL AND finished_at IS NOT NULL
+  ORDER BY finished_at DESC
+  LIMIT 100
+) recent
+`, JobSucceeded).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка расчёта длительности прогонов: %v", err)
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
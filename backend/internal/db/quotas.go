@@ -0,0 +1,256 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// AnonymousGroup — группа, квота которой действует на запуски без авторизации.
+const AnonymousGroup = "anonymous"
+
+// quotaLock вместе с ID пользователя сериализует постановку его заданий,
+// чтобы параллельные запросы не обошли квоту.
+const quotaLock = 7302
+
+// Quota ограничивает запуски пользователя; нулевые значения не ограничивают.
+// Квота группы — лимит по умолчанию для каждого её участника, а не общий
+// лимит группы. Все анонимные запуски считаются одним пользователем.
+type Quota struct {
+	MaxConcurrent   int   `json:"max_concurrent"`
+	MaxRunsPerDay   int   `json:"max_runs_per_day"`
+	MaxBudgetPerDay int64 `json:"max_budget_per_day"`
+}
+
+// Merge возвращает квоту, в которой ненулевые поля override заменяют поля q.
+func (q Quota) Merge(override Quota) Quota {
+	if override.MaxConcurrent > 0 {
+		q.MaxConcurrent = override.MaxConcurrent
+	}
+	if override.MaxRunsPerDay > 0 {
+		q.MaxRunsPerDay = override.MaxRunsPerDay
+	}
+	if override.MaxBudgetPerDay > 0 {
+		q.MaxBudgetPerDay = override.MaxBudgetPerDay
+	}
+	return q
+}
+
+// QuotaEntry — квота пользователя или группы в том виде, как она хранится.
+type QuotaEntry struct {
+	UserID int    `json:"user_id,omitempty"`
+	Group  string `json:"group,omitempty"`
+	Quota
+}
+
+// Usage — потребление пользователя. Сутки считаются от полуночи по времени БД.
+// Active — задания в очереди и выполняющиеся. Пакет в RunsToday считается
+// одним запуском. Бюджет берётся из expected_budget загруженных результатов;
+// незавершённые задания учитываются бюджетом, с которым их поставили.
+type Usage struct {
+	Active      int   `json:"active"`
+	RunsToday   int   `json:"runs_today"`
+	BudgetToday int64 `json:"budget_today"`
+}
+
+// Allowance — оставшийся запас по квоте; nil означает отсутствие ограничения.
+type Allowance struct {
+	Concurrent  *int   `json:"concurrent,omitempty"`
+	RunsToday   *int   `json:"runs_today,omitempty"`
+	BudgetToday *int64 `json:"budget_today,omitempty"`
+}
+
+func (q Quota) Remaining(u Usage) Allowance {
+	var a Allowance
+	if q.MaxConcurrent > 0 {
+		n := q.MaxConcurrent - u.Active
+		if n < 0 {
+			n = 0
+		}
+		a.Concurrent = &n
+	}
+	if q.MaxRunsPerDay > 0 {
+		n := q.MaxRunsPerDay - u.RunsToday
+		if n < 0 {
+			n = 0
+		}
+		a.RunsToday = &n
+	}
+	if q.MaxBudgetPerDay > 0 {
+		n := q.MaxBudgetPerDay - u.BudgetToday
+		if n < 0 {
+			n = 0
+		}
+		a.BudgetToday = &n
+	}
+	return a
+}
+
+func GetAllQuotas() ([]QuotaEntry, error) {
+	rows, err := DB.Query(`
+SELECT COALESCE(user_id, 0), COALESCE("group", ''), max_concurrent, max_runs_per_day, max_budget_per_day
+FROM quotas ORDER BY "group", user_id
+`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения квот: %v", err)
+	}
+	defer rows.Close()
+	list := []QuotaEntry{}
+	for rows.Next() {
+		var e QuotaEntry
+		if err := rows.Scan(&e.UserID, &e.Group, &e.MaxConcurrent, &e.MaxRunsPerDay, &e.MaxBudgetPerDay); err != nil {
+			return nil, fmt.Errorf("ошибка чтения квоты: %v", err)
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func SetUserQuota(userID int, q Quota) error {
+	_, err := DB.Exec(`
+INSERT INTO quotas (user_id, max_concurrent, max_runs_per_day, max_budget_per_day)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET max_concurrent = EXCLUDED.max_concurrent,
+    max_runs_per_day = EXCLUDED.max_runs_per_day,
+    max_budget_per_day = EXCLUDED.max_budget_per_day
+`, userID, q.MaxConcurrent, q.MaxRunsPerDay, q.MaxBudgetPerDay)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения квоты пользователя: %v", err)
+	}
+	return nil
+}
+
+func SetGroupQuota(group string, q Quota) error {
+	_, err := DB.Exec(`
+INSERT INTO quotas ("group", max_concurrent, max_runs_per_day, max_budget_per_day)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT ("group") DO UPDATE
+SET max_concurrent = EXCLUDED.max_concurrent,
+    max_runs_per_day = EXCLUDED.max_runs_per_day,
+    max_budget_per_day = EXCLUDED.max_budget_per_day
+`, group, q.MaxConcurrent, q.MaxRunsPerDay, q.MaxBudgetPerDay)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения квоты группы: %v", err)
+	}
+	return nil
+}
+
+// QuotaFor возвращает действующую квоту пользователя: квоту его группы,
+// дополненную его собственной. nil — анонимный запуск.
+func QuotaFor(user *User) (Quota, error) {
+	var userID interface{}
+	group := AnonymousGroup
+	if user != nil {
+		userID = user.ID
+		group = user.Group
+	}
+	rows, err := DB.Query(`
+SELECT user_id IS NOT NULL, max_concurrent, max_runs_per_day, max_budget_per_day
+FROM quotas WHERE user_id = $1 OR "group" = $2
+`, userID, group)
+	if err != nil {
+		return Quota{}, fmt.Errorf("ошибка получения квоты: %v", err)
+	}
+	defer rows.Close()
+	var groupQuota, userQuota Quota
+	for rows.Next() {
+		var personal bool
+		var q Quota
+		if err := rows.Scan(&personal, &q.MaxConcurrent, &q.MaxRunsPerDay, &q.MaxBudgetPerDay); err != nil {
+			return Quota{}, fmt.Errorf("ошибка чтения квоты: %v", err)
+		}
+		if personal {
+			userQuota = q
+		} else {
+			groupQuota = q
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Quota{}, fmt.Errorf("ошибка чтения квоты: %v", err)
+	}
+	return groupQuota.Merge(userQuota), nil
+}
+
+// QuotaCheck проверяет квоту по потреблению, посчитанному в транзакции
+// постановки заданий, и возвращает ошибку, если ставить их нельзя.
+type QuotaCheck func(Usage) error
+
+// checkQuota блокирует квоту пользователя до конца транзакции tx и
+// вызывает check с его текущим потреблением. nil check ничего не проверяет.
+func checkQuota(tx *sql.Tx, userID int, check QuotaCheck) error {
+	if check == nil {
+		return nil
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, quotaLock, userID); err != nil {
+		return fmt.Errorf("ошибка блокировки квоты: %v", err)
+	}
+	usage, err := getUsage(tx, userID)
+	if err != nil {
+		return err
+	}
+	return check(usage)
+}
+
+// MethodBudgets возвращает средний expected_budget прошлых результатов
+// методов из methodIDs. Методов без результатов в ответе нет.
+func MethodBudgets(methodIDs []int) (map[int]int64, error) {
+	rows, err := DB.Query(`
+SELECT method_id, avg(expected_budget) FROM optimization_results
+WHERE method_id = ANY($1)
+GROUP BY method_id
+`, pq.Array(methodIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка оценки бюджета: %v", err)
+	}
+	defer rows.Close()
+	budgets := make(map[int]int64, len(methodIDs))
+	for rows.Next() {
+		var id int
+		var budget float64
+		if err := rows.Scan(&id, &budget); err != nil {
+			return nil, fmt.Errorf("ошибка оценки бюджета: %v", err)
+		}
+		budgets[id] = int64(budget)
+	}
+	return budgets, rows.Err()
+}
+
+// GetUsage возвращает потребление пользователя; 0 — анонимные запуски.
+func GetUsage(userID int) (Usage, error) {
+	return getUsage(DB, userID)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func getUsage(q queryRower, userID int) (Usage, error) {
+	var uid interface{}
+	if userID > 0 {
+		uid = userID
+	}
+	var u Usage
+	var budget sql.NullFloat64
+	err := q.QueryRow(`
+SELECT
+  count(*) FILTER (WHERE j.status IN ($2, $3)),
+  count(*) FILTER (WHERE j.batch_id IS NULL AND j.created_at >= date_trunc('day', now()))
+    + count(DISTINCT j.batch_id) FILTER (WHERE j.created_at >= date_trunc('day', now())),
+  sum(COALESCE(r.expected_budget, CASE WHEN j.status IN ($2, $3) THEN COALESCE(j.budget, m.budget) END))
+    FILTER (WHERE j.created_at >= date_trunc('day', now()))
+FROM jobs j
+LEFT JOIN optimization_results r ON r.result_id = j.result_id
+LEFT JOIN (
+  SELECT method_id, avg(expected_budget) AS budget FROM optimization_results GROUP BY method_id
+) m ON m.method_id = j.method_id
+WHERE j.user_id IS NOT DISTINCT FROM $1::integer
+  AND (j.status IN ($2, $3) OR j.created_at >= date_trunc('day', now()))
+`, uid, JobQueued, JobRunning).Scan(&u.Active, &u.RunsToday, &budget)
+	if err != nil {
+		return Usage{}, fmt.Errorf("ошибка подсчёта потребления: %v", err)
+	}
+	u.BudgetToday = int64(budget.Float64)
+	return u, nil
+}
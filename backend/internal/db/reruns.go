@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"math"
+)
+
+// RerunComparison сравнивает лучшую точку повторного прогона с исходной.
+// DiffF и MaxDiffX не заполняются, если разница не определена: разная
+// размерность x или бесконечные значения.
+type RerunComparison struct {
+	OriginalID string `json:"original_id"`
+	ResultID   string `json:"result_id"`
+	// Identical — best_result_f и best_result_x совпадают побитово.
+	Identical       bool     `json:"identical"`
+	WithinTolerance bool     `json:"within_tolerance"`
+	Tolerance       float64  `json:"tolerance"`
+	DiffF           *float64 `json:"diff_f,omitempty"`
+	MaxDiffX        *float64 `json:"max_diff_x,omitempty"`
+	SameImage       bool     `json:"same_image"`
+	SameSource      bool     `json:"same_source"`
+}
+
+// CompareResults сравнивает rerun с original. Значения считаются близкими,
+// если |a-b| <= tol * max(1, |a|, |b|).
+func CompareResults(original, rerun OptimizationResult, tol float64) RerunComparison {
+	c := RerunComparison{
+		OriginalID: original.ResultID,
+		ResultID:   rerun.ResultID,
+		Tolerance:  tol,
+		SameImage:  original.ImageDigest != "" && original.ImageDigest == rerun.ImageDigest,
+		SameSource: original.SourceHash != "" && original.SourceHash == rerun.SourceHash,
+	}
+
+	fa, fb := parseBestF(original.BestResult), parseBestF(rerun.BestResult)
+	xa, xb := parseBestX(original.BestResult), parseBestX(rerun.BestResult)
+	c.Identical = math.Float64bits(fa) == math.Float64bits(fb) && len(xa) == len(xb)
+	c.WithinTolerance = closeEnough(fa, fb, tol) && len(xa) == len(xb)
+	c.DiffF = finiteDiff(fa, fb)
+
+	if len(xa) != len(xb) {
+		return c
+	}
+	maxDiff := 0.0
+	for i := range xa {
+		if math.Float64bits(xa[i]) != math.Float64bits(xb[i]) {
+			c.Identical = false
+		}
+		if !closeEnough(xa[i], xb[i], tol) {
+			c.WithinTolerance = false
+		}
+		d := finiteDiff(xa[i], xb[i])
+		if d == nil {
+			return c
+		}
+		maxDiff = math.Max(maxDiff, *d)
+	}
+	c.MaxDiffX = &maxDiff
+	return c
+}
+
+// closeEnough считает несовпадающие NaN и бесконечности далёкими: иначе
+// допуск, умноженный на бесконечность, принял бы любую разницу.
+func closeEnough(a, b, tol float64) bool {
+	if math.Float64bits(a) == math.Float64bits(b) {
+		return true
+	}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) || math.IsNaN(a) || math.IsNaN(b) {
+		return false
+	}
+	return math.Abs(a-b) <= tol*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func finiteDiff(a, b float64) *float64 {
+	if math.Float64bits(a) == math.Float64bits(b) {
+		d := 0.0
+		return &d
+	}
+	d := math.Abs(a - b)
+	if math.IsNaN(d) || math.IsInf(d, 0) {
+		return nil
+	}
+	return &d
+}
+
+// GetReruns возвращает задания, повторяющие результат resultID, старые первыми.
+func GetReruns(resultID string) ([]Job, error) {
+	rows, err := DB.Query(`SELECT `+jobColumns+` FROM jobs WHERE rerun_of = $1 ORDER BY id`, resultID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса повторных прогонов: %v", err)
+	}
+	defer rows.Close()
+	return scanJobs(rows)
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompareResults(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	fp := func(v float64) *float64 { return &v }
+	type point struct {
+		f float64
+		x []float64
+	}
+	tests := []struct {
+		name          string
+		a, b          point
+		tol           float64
+		wantIdentical bool
+		wantWithin    bool
+		wantDiffF     *float64
+		wantMaxDiffX  *float64
+	}{
+		{"identical", point{1.5, []float64{1, 2}}, point{1.5, []float64{1, 2}}, 1e-9, true, true, fp(0), fp(0)},
+		{"within tolerance", point{1, []float64{1, 2}}, point{1 + 1e-12, []float64{1, 2 + 1e-12}}, 1e-9, false, true, fp(1e-12), fp(1e-12)},
+		{"tolerance is relative", point{1e6, []float64{0}}, point{1e6 + 0.5, []float64{0}}, 1e-6, false, true, fp(0.5), fp(0)},
+		{"outside tolerance", point{1, []float64{1}}, point{1.1, []float64{1}}, 1e-9, false, false, fp(0.1), fp(0)},
+		{"x outside tolerance", point{1, []float64{1, 2}}, point{1, []float64{1, 3}}, 1e-9, false, false, fp(0), fp(1)},
+		{"different x length", point{1, []float64{1, 2}}, point{1, []float64{1, 2, 3}}, 1e-9, false, false, fp(0), nil},
+		{"same NaN", point{nan, []float64{1}}, point{nan, []float64{1}}, 1e-9, true, true, fp(0), fp(0)},
+		{"NaN against number", point{nan, []float64{1}}, point{1, []float64{1}}, 1e-9, false, false, nil, fp(0)},
+		{"same infinity", point{inf, []float64{1}}, point{inf, []float64{1}}, 1e-9, true, true, fp(0), fp(0)},
+		{"opposite infinities", point{inf, []float64{1}}, point{-inf, []float64{1}}, 1e-9, false, false, nil, fp(0)},
+		{"infinite x", point{1, []float64{inf}}, point{1, []float64{0}}, 1e-9, false, false, fp(0), nil},
+		{"zero tolerance equal", point{1, []float64{2}}, point{1, []float64{2}}, 0, true, true, fp(0), fp(0)},
+		{"zero tolerance next float", point{1, []float64{2}}, point{math.Nextafter(1, 2), []float64{2}}, 0, false, false, fp(math.Nextafter(1, 2) - 1), fp(0)},
+		{"negative zero", point{0, []float64{0}}, point{math.Copysign(0, -1), []float64{0}}, 0, false, true, fp(0), fp(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := OptimizationResult{ResultID: "a", BestResult: bestResultMap(tt.a.x, tt.a.f, nil, nil, nil)}
+			rerun := OptimizationResult{ResultID: "b", BestResult: bestResultMap(tt.b.x, tt.b.f, nil, nil, nil)}
+			c := CompareResults(original, rerun, tt.tol)
+			if c.Identical != tt.wantIdentical {
+				t.Errorf("Identical = %v, want %v", c.Identical, tt.wantIdentical)
+			}
+			if c.WithinTolerance != tt.wantWithin {
+				t.Errorf("WithinTolerance = %v, want %v", c.WithinTolerance, tt.wantWithin)
+			}
+			checkDiff(t, "DiffF", c.DiffF, tt.wantDiffF)
+			checkDiff(t, "MaxDiffX", c.MaxDiffX, tt.wantMaxDiffX)
+		})
+	}
+}
+
+func TestCompareResultsProvenance(t *testing.T) {
+	br := bestResultMap([]float64{1}, 1, nil, nil, nil)
+	original := OptimizationResult{BestResult: br, ImageDigest: "sha256:a", SourceHash: "h"}
+
+	c := CompareResults(original, OptimizationResult{BestResult: br, ImageDigest: "sha256:a", SourceHash: "h"}, 0)
+	if !c.SameImage || !c.SameSource {
+		t.Errorf("SameImage = %v, SameSource = %v, want both true", c.SameImage, c.SameSource)
+	}
+	c = CompareResults(OptimizationResult{BestResult: br}, OptimizationResult{BestResult: br}, 0)
+	if c.SameImage || c.SameSource {
+		t.Errorf("empty provenance compared as equal: SameImage = %v, SameSource = %v", c.SameImage, c.SameSource)
+	}
+}
+
+func checkDiff(t *testing.T, name string, got, want *float64) {
+	t.Helper()
+	switch {
+	case want == nil && got != nil:
+		t.Errorf("%s = %v, want nil", name, *got)
+	case want != nil && got == nil:
+		t.Errorf("%s = nil, want %v", name, *want)
+	case want != nil && math.Abs(*got-*want) > 1e-15:
+		t.Errorf("%s = %v, want %v", name, *got, *want)
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -9,6 +10,9 @@ import (
 	"github.com/lib/pq"
 )
 
+// ErrResultNotFound возвращает LoadOptimizationResult для неизвестного result_id.
+var ErrResultNotFound = errors.New("result not found")
+
 type OptimizationResult struct {
 	UserID           int                    `json:"user_id"`
 	AlgorithmName    string                 `json:"algorithm_name"`
@@ -19,6 +23,18 @@ type OptimizationResult struct {
 	BestResult       map[string]float64     `json:"best_result"`
 	ResultID         string                 `json:"result_id"`
 	Problem          string                 `json:"problem"`
+	ImageDigest      string                 `json:"image_digest"`
+	SourceHash       string                 `json:"source_hash"`
+	RunVersion       string                 `json:"run_version"`
+	// Ограничения лучшей точки (g ≤ 0) и их суммарное нарушение max(0, g).
+	ConstraintNames     []string  `json:"constraint_names"`
+	ConstraintValues    []float64 `json:"constraint_values"`
+	ConstraintViolation float64   `json:"constraint_violation"`
+	Feasible            bool      `json:"feasible"`
+	// Hypervolume заполняется поиском, если задана опорная точка.
+	Hypervolume *float64 `json:"hypervolume,omitempty"`
+	// History заполняется из results.csv при загрузке и сохраняется вместе с результатом.
+	History *History `json:"-"`
 }
 
 func InsertOptimizationResult(or OptimizationResult) error {
@@ -72,8 +88,10 @@ func InsertOptimizationResult(or OptimizationResult) error {
 INSERT INTO optimization_results
   (user_id, result_id, method_id, problem, algorithm_name, algorithm_version,
    dimension, instance_id, algorithm, seed,
-   expected_budget, actual_budget, best_result_x, best_result_f)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+   expected_budget, actual_budget, best_result_x, best_result_f,
+   image_digest, source_hash, run_version, best_result_objectives,
+   constraint_names, constraint_values, constraint_violation, feasible, feasibility_tolerance)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23)
 `,
 		userIDParam,
 		or.ResultID,
@@ -89,6 +107,15 @@ VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
 		or.ActualBudget,
 		pq.Array(parseBestX(or.BestResult)),
 		parseBestF(or.BestResult),
+		or.ImageDigest,
+		or.SourceHash,
+		or.RunVersion,
+		pq.Array(parseBestObjectives(or.BestResult)),
+		pq.Array(or.ConstraintNames),
+		pq.Array(or.ConstraintValues),
+		or.ConstraintViolation,
+		or.Feasible,
+		FeasibilityTolerance,
 	)
 	if err != nil {
 		return fmt.Errorf("insert optimization_results: %v", err)
@@ -135,6 +162,15 @@ ON CONFLICT (result_id,name) DO UPDATE
 		}
 	}
 
+	if or.History != nil {
+		if err := insertHistory(tx, or.ResultID, or.History); err != nil {
+			return err
+		}
+		if err := insertParetoFront(tx, or.ResultID, or.History, FeasibilityTolerance); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -155,7 +191,39 @@ func parseBestF(br map[string]float64) float64 {
 	return br["f[1]"]
 }
 
-func GetOptimizationResults(limitStr, offsetStr string, userID int) ([]OptimizationResult, error) {
+func parseBestObjectives(br map[string]float64) []float64 {
+	fs := []float64{}
+	for i := 1; ; i++ {
+		v, ok := br[fmt.Sprintf("f[%d]", i)]
+		if !ok {
+			break
+		}
+		fs = append(fs, v)
+	}
+	return fs
+}
+
+// bestResultMap собирает best_result в том виде, в каком его пишет run.py.
+func bestResultMap(bestX []float64, bestF float64, objectives []float64, constraintNames []string, constraints []float64) map[string]float64 {
+	br := make(map[string]float64, len(bestX)+len(objectives)+len(constraints)+1)
+	for i, v := range bestX {
+		br[fmt.Sprintf("x[%d]", i)] = v
+	}
+	br["f[1]"] = bestF
+	for i, v := range objectives {
+		br[fmt.Sprintf("f[%d]", i+1)] = v
+	}
+	for i, name := range constraintNames {
+		if i < len(constraints) {
+			br[name] = constraints[i]
+		}
+	}
+	return br
+}
+
+// GetOptimizationResults возвращает результаты пользователя либо, если
+// experimentID не равен 0, результаты эксперимента.
+func GetOptimizationResults(limitStr, offsetStr string, userID, experimentID int) ([]OptimizationResult, error) {
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid limit %q: %v", limitStr, err)
@@ -168,12 +236,16 @@ func GetOptimizationResults(limitStr, offsetStr string, userID int) ([]Optimizat
 	rows, err := DB.Query(`
 SELECT result_id, problem, algorithm_name, algorithm_version,
        expected_budget, actual_budget,
-       best_result_x, best_result_f
+       best_result_x, best_result_f,
+       image_digest, source_hash, run_version, best_result_objectives,
+       constraint_names, constraint_values, constraint_violation, feasible
 FROM optimization_results
-WHERE user_id = $1
+WHERE CASE WHEN $4 = 0 THEN user_id = $1
+           ELSE result_id IN (SELECT result_id FROM experiment_results WHERE experiment_id = $4)
+      END
 ORDER BY result_id DESC
 LIMIT $2 OFFSET $3
-`, userID, limit, offset)
+`, userID, limit, offset, experimentID)
 	if err != nil {
 		return nil, fmt.Errorf("query optimization_results: %v", err)
 	}
@@ -182,7 +254,7 @@ LIMIT $2 OFFSET $3
 	var results []OptimizationResult
 	for rows.Next() {
 		var or OptimizationResult
-		var bestX []float64
+		var bestX, objectives []float64
 		var bestF float64
 
 		if err := rows.Scan(
@@ -194,16 +266,18 @@ LIMIT $2 OFFSET $3
 			&or.ActualBudget,
 			pq.Array(&bestX),
 			&bestF,
+			&or.ImageDigest,
+			&or.SourceHash,
+			&or.RunVersion,
+			pq.Array(&objectives),
+			pq.Array(&or.ConstraintNames),
+			pq.Array(&or.ConstraintValues),
+			&or.ConstraintViolation,
+			&or.Feasible,
 		); err != nil {
 			return nil, fmt.Errorf("scan optimization_results: %v", err)
 		}
-
-		br := make(map[string]float64, len(bestX)+1)
-		for i, v := range bestX {
-			br[fmt.Sprintf("x[%d]", i)] = v
-		}
-		br["f[1]"] = bestF
-		or.BestResult = br
+		or.BestResult = bestResultMap(bestX, bestF, objectives, or.ConstraintNames, or.ConstraintValues)
 
 		paramRows, err := DB.Query(`
 SELECT name, value_text, value_numeric, type
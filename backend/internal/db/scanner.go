@@ -2,59 +2,144 @@ package db
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 )
 
+const (
+	ProcessedSuffix = ".processed"
+	// CancelledSuffix помечает частичные результаты отменённых заданий.
+	CancelledSuffix = ".cancelled"
+	// UploadSuffix — папка, в которую ещё загружаются результаты удалённого воркера.
+	UploadSuffix = ".upload"
+	// FailedSuffix — папка, которую не удалось загрузить; её судьбу решает администратор.
+	FailedSuffix = ".failed"
+)
+
+// ResultsFile — файл, появление которого означает, что запуск записал результаты.
+const ResultsFile = "results.json"
+
+// HistoryFile — все вычисления запуска, загружаются в optimization_history.
+const HistoryFile = "results.csv"
+
+// ingestMu не даёт сканеру и наблюдателю загрузить одну папку дважды.
+var ingestMu sync.Mutex
+
+// SkipResultsDir сообщает, что папка с таким именем уже обработана или ещё не готова.
+func SkipResultsDir(name string) bool {
+	return strings.HasSuffix(name, ProcessedSuffix) ||
+		strings.HasSuffix(name, CancelledSuffix) ||
+		strings.HasSuffix(name, UploadSuffix) ||
+		strings.HasSuffix(name, FailedSuffix)
+}
+
 func ScanResultsFolder(resultsDir string) error {
 	return filepath.WalkDir(resultsDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() && strings.HasSuffix(d.Name(), ".processed") {
+		if d.IsDir() && SkipResultsDir(d.Name()) {
 			return filepath.SkipDir
 		}
-		if !d.IsDir() && d.Name() == "results.json" {
-			data, err := ioutil.ReadFile(path)
-			if err != nil {
-				log.Printf("Ошибка чтения %s: %v", path, err)
-				return nil
-			}
-			var res OptimizationResult
-			if err := json.Unmarshal(data, &res); err != nil {
-				log.Printf("Ошибка парсинга JSON %s: %v", path, err)
-				return nil
-			}
-			parent := filepath.Dir(path)
-			res.ResultID = filepath.Base(parent)
-
-			if err := InsertOptimizationResult(res); err != nil {
-				log.Printf("Ошибка вставки %s: %v", path, err)
-				return nil
-			}
-			log.Printf("Вставлен результат из %s", path)
-
-			newDir := parent + ".processed"
-			if err := os.Rename(parent, newDir); err != nil {
-				log.Printf("Ошибка переименования %s: %v", parent, err)
-			}
+		if !d.IsDir() && d.Name() == ResultsFile {
+			IngestResultsDir(filepath.Dir(path))
 		}
 		return nil
 	})
 }
 
-func StartCronTask(resultsDir string, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			if err := ScanResultsFolder(resultsDir); err != nil {
-				log.Printf("Ошибка при сканировании: %v", err)
-			}
-		}
-	}()
+// IngestResultsDir загружает results.json из папки запуска и переименовывает
+// папку с суффиксом ProcessedSuffix. Папка без results.json пропускается, а
+// папка, которую не удалось загрузить, переносится в карантин.
+func IngestResultsDir(dir string) {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+	_ = ingestDir(dir)
+}
+
+// ingestDir вызывается под ingestMu. Ошибка загрузки возвращается обёрнутой
+// в ErrIngestFailed.
+func ingestDir(dir string) error {
+	path := filepath.Join(dir, ResultsFile)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Ошибка чтения %s: %v", path, err)
+		return quarantine(dir, "ошибка чтения results.json: "+err.Error())
+	}
+	var res OptimizationResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		log.Printf("Ошибка парсинга JSON %s: %v", path, err)
+		return quarantine(dir, "ошибка парсинга results.json: "+err.Error())
+	}
+	res.ResultID = filepath.Base(dir)
+	// Без истории результат всё равно загружается: она нужна только для кривых сходимости.
+	if res.History, err = readHistory(filepath.Join(dir, HistoryFile)); err != nil {
+		log.Printf("Ошибка чтения истории %s: %v", dir, err)
+	}
+	applyFeasibility(&res, FeasibilityTolerance)
+
+	if err := InsertOptimizationResult(res); err != nil {
+		log.Printf("Ошибка вставки %s: %v", path, err)
+		return quarantine(dir, err.Error())
+	}
+	log.Printf("Вставлен результат из %s", path)
+	if err := LinkJobResult(res.ResultID); err != nil {
+		log.Printf("%v", err)
+	}
+	if err := clearIngestFailure(res.ResultID); err != nil {
+		log.Printf("%v", err)
+	}
+
+	newDir := dir + ProcessedSuffix
+	if err := os.Rename(dir, newDir); err != nil {
+		log.Printf("Ошибка переименования %s: %v", dir, err)
+	}
+	return nil
+}
+
+// quarantine записывает ошибку загрузки и переносит папку в <dir>.failed,
+// чтобы сканирование не повторяло её снова и снова. Если ошибку не удалось
+// записать, например из-за недоступной БД, папка остаётся на месте и
+// загрузка повторится при следующем сканировании.
+func quarantine(dir, message string) error {
+	resultID := filepath.Base(dir)
+	failure := fmt.Errorf("%w: %s", ErrIngestFailed, message)
+	if err := upsertQuarantine(resultID, message); err != nil {
+		log.Printf("%v", err)
+		return failure
+	}
+	ingestFailed(resultID, message)
+	if err := os.Rename(dir, dir+FailedSuffix); err != nil {
+		log.Printf("Ошибка переименования %s: %v", dir, err)
+		return failure
+	}
+	log.Printf("Папка %s перенесена в карантин", dir)
+	return failure
+}
+
+func readHistory(path string) (*History, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHistoryCSV(f)
+}
+
+func ingestFailed(resultID, message string) {
+	if err := RecordIngestFailure(resultID, message); err != nil {
+		log.Printf("%v", err)
+	}
 }
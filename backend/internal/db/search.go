@@ -139,6 +139,34 @@ func SearchOptimizationResultsWithRange(params map[string]interface{}) ([]Optimi
                 name, strings.Join(ph, ","),
             )
 
+        case ExperimentScope:
+            // только результаты эксперимента
+            clause = fmt.Sprintf(
+                "SELECT result_id FROM experiment_results WHERE experiment_id = $%d",
+                idx,
+            )
+            args = append(args, int(v))
+            idx++
+
+        case FeasibleScope:
+            // только допустимые или только недопустимые результаты
+            clause = fmt.Sprintf(
+                "SELECT result_id FROM optimization_results WHERE feasible = $%d",
+                idx,
+            )
+            args = append(args, bool(v))
+            idx++
+
+        case ViolationRange:
+            // суммарное нарушение ограничений лучшей точки
+            clause = fmt.Sprintf(
+                "SELECT result_id FROM optimization_results "+
+                    "WHERE constraint_violation BETWEEN $%d AND $%d",
+                idx, idx+1,
+            )
+            args = append(args, v.Min, v.Max)
+            idx += 2
+
         case int, float64:
             // старый режим: единичное число ±10%
             f := toFloat(v)
@@ -226,36 +254,44 @@ func LoadOptimizationResult(resultID string) (OptimizationResult, error) {
 	or.ResultID = resultID
 	or.Parameters = make(map[string]interface{})
 
-	var bestX []float64
+	var bestX, objectives []float64
 	var bestF float64
 
 	row := DB.QueryRow(`
-SELECT algorithm_name, algorithm_version,
+SELECT COALESCE(user_id, 0), problem, algorithm_name, algorithm_version,
        expected_budget, actual_budget,
-       best_result_x, best_result_f
+       best_result_x, best_result_f,
+       image_digest, source_hash, run_version, best_result_objectives,
+       constraint_names, constraint_values, constraint_violation, feasible
 FROM optimization_results
 WHERE result_id = $1
 `, resultID)
 
 	if err := row.Scan(
+		&or.UserID,
+		&or.Problem,
 		&or.AlgorithmName,
 		&or.AlgorithmVersion,
 		&or.ExpectedBudget,
 		&or.ActualBudget,
 		pq.Array(&bestX),
 		&bestF,
+		&or.ImageDigest,
+		&or.SourceHash,
+		&or.RunVersion,
+		pq.Array(&objectives),
+		pq.Array(&or.ConstraintNames),
+		pq.Array(&or.ConstraintValues),
+		&or.ConstraintViolation,
+		&or.Feasible,
 	); err != nil {
 		if err == sql.ErrNoRows {
-			return or, fmt.Errorf("result %s not found", resultID)
+			return or, fmt.Errorf("%w: %s", ErrResultNotFound, resultID)
 		}
 		return or, err
 	}
 
-	or.BestResult = make(map[string]float64, len(bestX)+1)
-	for i, x := range bestX {
-		or.BestResult[fmt.Sprintf("x[%d]", i)] = x
-	}
-	or.BestResult["f[1]"] = bestF
+	or.BestResult = bestResultMap(bestX, bestF, objectives, or.ConstraintNames, or.ConstraintValues)
 
 	rows, err := DB.Query(`
 SELECT name, value_text, value_numeric, type
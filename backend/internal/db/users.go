@@ -6,17 +6,18 @@ import (
 )
 
 type User struct {
-	ID       int    `json:"id"`
-	Login    string `json:"login"`
-	Password string `json:"password"`
-	Group    string `json:"group"`
+	ID       int     `json:"id"`
+	Login    string  `json:"login"`
+	Password string  `json:"password"`
+	Group    string  `json:"group"`
+	Weight   float64 `json:"weight"`
 }
 
 func FindUserByLogin(login string) (*User, error) {
-	row := DB.QueryRow(`SELECT id, login, password, "group" FROM users WHERE login = $1`, login)
+	row := DB.QueryRow(`SELECT id, login, password, "group", weight FROM users WHERE login = $1`, login)
 
 	var u User
-	if err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Group); err != nil {
+	if err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Group, &u.Weight); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
 		}
@@ -26,10 +27,10 @@ func FindUserByLogin(login string) (*User, error) {
 }
 
 func FindUserById(id int) (*User, error) {
-	row := DB.QueryRow(`SELECT id, login, password, "group" FROM users WHERE id = $1`, id)
+	row := DB.QueryRow(`SELECT id, login, password, "group", weight FROM users WHERE id = $1`, id)
 
 	var u User
-	if err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Group); err != nil {
+	if err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Group, &u.Weight); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
 		}
@@ -51,3 +52,12 @@ func CreateUser(login, password, group string) (int, error) {
 	}
 	return id, nil
 }
+
+// UpdateUserWeight меняет вес пользователя в справедливом разделении очереди.
+func UpdateUserWeight(id int, weight float64) error {
+	_, err := DB.Exec(`UPDATE users SET weight = $2 WHERE id = $1`, id, weight)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления веса пользователя: %v", err)
+	}
+	return nil
+}
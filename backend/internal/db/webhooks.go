@@ -0,0 +1,369 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// События, на которые подписываются вебхуки.
+const (
+	// EventJobSucceeded отправляется, когда задание завершилось успешно и его
+	// результат загружен, в каком бы порядке это ни произошло.
+	EventJobSucceeded = "job.succeeded"
+	// EventJobFailed — задание упало или превысило таймаут после всех повторов.
+	EventJobFailed = "job.failed"
+	// EventBatchFinished — все задания пакета в конечном состоянии.
+	EventBatchFinished = "batch.finished"
+	// EventIngestFailed — results.json прогона не удалось загрузить.
+	EventIngestFailed = "ingestion.failed"
+)
+
+// WebhookEvents — все допустимые события.
+var WebhookEvents = []string{EventJobSucceeded, EventJobFailed, EventBatchFinished, EventIngestFailed}
+
+// Состояния доставки вебхука.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID     int      `json:"id"`
+	UserID int      `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret подписывает тело запроса и показывается только при создании.
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookPayload — тело запроса вебхука.
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Job       *Job      `json:"job,omitempty"`
+	Batch     *Batch    `json:"batch,omitempty"`
+	ResultID  string    `json:"result_id,omitempty"`
+	BestF     *float64  `json:"best_f,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	// URL и Secret заполняются для доставок, выданных диспетчеру.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+const webhookColumns = `id, user_id, url, events, active, created_at`
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var h Webhook
+	if err := row.Scan(&h.ID, &h.UserID, &h.URL, pq.Array(&h.Events), &h.Active, &h.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func InsertWebhook(h *Webhook) (int, error) {
+	var id int
+	err := DB.QueryRow(`
+INSERT INTO webhooks (user_id, url, secret, events) VALUES ($1, $2, $3, $4)
+RETURNING id
+`, h.UserID, h.URL, h.Secret, pq.Array(h.Events)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания вебхука: %v", err)
+	}
+	return id, nil
+}
+
+func GetWebhook(id int) (*Webhook, error) {
+	h, err := scanWebhook(DB.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения вебхука: %v", err)
+	}
+	return h, nil
+}
+
+func GetWebhooksByUser(userID int) ([]Webhook, error) {
+	rows, err := DB.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса вебхуков: %v", err)
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования вебхука: %v", err)
+		}
+		hooks = append(hooks, *h)
+	}
+	return hooks, rows.Err()
+}
+
+func UpdateWebhook(h *Webhook) error {
+	_, err := DB.Exec(`
+UPDATE webhooks SET url = $2, events = $3, active = $4 WHERE id = $1
+`, h.ID, h.URL, pq.Array(h.Events), h.Active)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления вебхука %d: %v", h.ID, err)
+	}
+	return nil
+}
+
+func DeleteWebhook(id int) error {
+	if _, err := DB.Exec(`DELETE FROM webhooks WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("ошибка удаления вебхука %d: %v", id, err)
+	}
+	return nil
+}
+
+// enqueueWebhookEvent ставит доставку события всем активным вебхукам
+// пользователя, подписанным на него. Вызывается в транзакции, которая
+// меняет состояние, поэтому событие не теряется и не дублируется.
+func enqueueWebhookEvent(ex execer, userID int, payload WebhookPayload) error {
+	if userID == 0 {
+		return nil
+	}
+	payload.CreatedAt = time.Now()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации события %s: %v", payload.Event, err)
+	}
+	_, err = ex.Exec(`
+INSERT INTO webhook_deliveries (webhook_id, event, payload)
+SELECT id, $2, $3 FROM webhooks WHERE user_id = $1 AND active AND $2 = ANY(events)
+`, userID, payload.Event, raw)
+	if err != nil {
+		return fmt.Errorf("ошибка постановки события %s: %v", payload.Event, err)
+	}
+	return nil
+}
+
+// notifyJob отправляет payload, если он задан, вебхукам владельца задания id
+// и завершает пакет задания, если в нём не осталось незавершённых заданий.
+func notifyJob(tx *sql.Tx, id int, payload *WebhookPayload) error {
+	job, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err != nil {
+		return fmt.Errorf("ошибка получения задания %d: %v", id, err)
+	}
+	if payload != nil {
+		payload.Job = job
+		if err := enqueueWebhookEvent(tx, job.UserID, *payload); err != nil {
+			return err
+		}
+	}
+	if job.BatchID != 0 {
+		return finishBatch(tx, job.BatchID)
+	}
+	return nil
+}
+
+// finishBatch отмечает пакет завершённым и отправляет batch.finished, когда
+// в нём не осталось заданий в очереди и выполняющихся. Строка пакета
+// блокируется, чтобы из одновременно завершившихся заданий событие
+// отправило ровно одно.
+func finishBatch(tx *sql.Tx, batchID int) error {
+	if _, err := tx.Exec(`SELECT id FROM batches WHERE id = $1 FOR UPDATE`, batchID); err != nil {
+		return fmt.Errorf("ошибка блокировки пакета %d: %v", batchID, err)
+	}
+	b, err := scanBatch(tx.QueryRow(`
+UPDATE batches SET finished_at = now()
+WHERE id = $1 AND finished_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM jobs WHERE batch_id = $1 AND status IN ($2, $3))
+RETURNING `+batchColumns, batchID, JobQueued, JobRunning))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка завершения пакета %d: %v", batchID, err)
+	}
+	rows, err := tx.Query(`SELECT status, count(*) FROM jobs WHERE batch_id = $1 GROUP BY status`, batchID)
+	if err != nil {
+		return fmt.Errorf("ошибка подсчёта заданий пакета %d: %v", batchID, err)
+	}
+	defer rows.Close()
+	b.Counts = make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return fmt.Errorf("ошибка подсчёта заданий пакета %d: %v", batchID, err)
+		}
+		b.Counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return enqueueWebhookEvent(tx, b.UserID, WebhookPayload{Event: EventBatchFinished, Batch: b})
+}
+
+// RecordIngestFailure отмечает, что результат задания с тегом resultID не
+// загрузился. Сканер повторяет попытки, но событие отправляется один раз,
+// пока причина не изменится.
+func RecordIngestFailure(resultID, message string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var jobID int
+	err = tx.QueryRow(`SELECT id FROM jobs WHERE tag = $1 FOR UPDATE`, resultID).Scan(&jobID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения задания %s: %v", resultID, err)
+	}
+	var last JobEvent
+	err = tx.QueryRow(`
+SELECT status, message FROM job_events WHERE job_id = $1 ORDER BY id DESC LIMIT 1
+`, jobID).Scan(&last.Status, &last.Message)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("ошибка запроса событий задания %d: %v", jobID, err)
+	}
+	if last.Status == JobIngestFailed && last.Message == message {
+		return nil
+	}
+	if err := recordJobEvent(tx, jobID, JobIngestFailed, message); err != nil {
+		return err
+	}
+	payload := &WebhookPayload{Event: EventIngestFailed, ResultID: resultID, Error: message}
+	if err := notifyJob(tx, jobID, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClaimWebhookDeliveries выдаёт до limit доставок, время которых подошло, и
+// откладывает их на lease, чтобы доставку не взял другой экземпляр бэкенда.
+func ClaimWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	rows, err := DB.Query(`
+UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $3)
+FROM webhooks h
+WHERE h.id = d.webhook_id AND d.id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = $1 AND next_attempt_at <= now()
+  ORDER BY next_attempt_at, id
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, h.url, h.secret
+`, DeliveryPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выдачи доставок вебхуков: %v", err)
+	}
+	defer rows.Close()
+
+	var list []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования доставки: %v", err)
+		}
+		d.Payload = payload
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// RecordWebhookAttempt сохраняет исход попытки доставки. При неудаче
+// доставка повторяется через retryIn; нулевой retryIn завершает её как failed.
+func RecordWebhookAttempt(id int64, delivered bool, responseStatus int, errMsg string, retryIn time.Duration) error {
+	var code interface{}
+	if responseStatus != 0 {
+		code = responseStatus
+	}
+	var err error
+	switch {
+	case delivered:
+		_, err = DB.Exec(`
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, response_status = $3, last_error = '',
+    next_attempt_at = NULL, delivered_at = now()
+WHERE id = $1
+`, id, DeliveryDelivered, code)
+	case retryIn > 0:
+		_, err = DB.Exec(`
+UPDATE webhook_deliveries
+SET attempts = attempts + 1, response_status = $2, last_error = $3,
+    next_attempt_at = now() + make_interval(secs => $4)
+WHERE id = $1
+`, id, code, errMsg, retryIn.Seconds())
+	default:
+		_, err = DB.Exec(`
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, response_status = $3, last_error = $4,
+    next_attempt_at = NULL
+WHERE id = $1
+`, id, DeliveryFailed, code, errMsg)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения доставки %d: %v", id, err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries возвращает журнал доставок вебхука, новые первыми.
+func GetWebhookDeliveries(webhookID, limit, offset int) ([]WebhookDelivery, error) {
+	rows, err := DB.Query(`
+SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at,
+       response_status, last_error, created_at, delivered_at
+FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY id DESC
+LIMIT $2 OFFSET $3
+`, webhookID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса доставок: %v", err)
+	}
+	defer rows.Close()
+
+	var list []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload []byte
+		var nextAttempt, deliveredAt sql.NullTime
+		var responseStatus sql.NullInt64
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &nextAttempt,
+			&responseStatus, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования доставки: %v", err)
+		}
+		d.Payload = payload
+		if nextAttempt.Valid {
+			d.NextAttemptAt = &nextAttempt.Time
+		}
+		if responseStatus.Valid {
+			code := int(responseStatus.Int64)
+			d.ResponseStatus = &code
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
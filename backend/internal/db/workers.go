@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	WorkerOnline = "online"
+	WorkerLost   = "lost"
+)
+
+type Worker struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Capacity      int       `json:"capacity"`
+	Runner        string    `json:"runner"`
+	Status        string    `json:"status"`
+	Running       int       `json:"running"`
+	RegisteredAt  time.Time `json:"registered_at"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+}
+
+const workerSelect = `
+SELECT w.id, w.name, w.capacity, w.runner, w.status,
+       (SELECT count(*) FROM jobs j WHERE j.worker_id = w.id AND j.status = 'running'),
+       w.registered_at, w.last_heartbeat
+FROM workers w`
+
+func scanWorker(row rowScanner) (*Worker, error) {
+	var w Worker
+	if err := row.Scan(
+		&w.ID, &w.Name, &w.Capacity, &w.Runner, &w.Status,
+		&w.Running, &w.RegisteredAt, &w.LastHeartbeat,
+	); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// RegisterWorker регистрирует воркер или обновляет запись при повторной
+// регистрации. Задания, числившиеся за воркером до перезапуска, возвращаются в очередь.
+func RegisterWorker(name string, capacity int, runnerKind string) (int, error) {
+	var id int
+	err := DB.QueryRow(`
+INSERT INTO workers (name, capacity, runner)
+VALUES ($1, $2, $3)
+ON CONFLICT (name) DO UPDATE
+  SET capacity = EXCLUDED.capacity,
+      runner = EXCLUDED.runner,
+      status = 'online',
+      registered_at = now(),
+      last_heartbeat = now()
+RETURNING id
+`, name, capacity, runnerKind).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка регистрации воркера: %v", err)
+	}
+	if err := RequeueWorkerJobs(id, "воркер перерегистрировался"); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func GetWorker(id int) (*Worker, error) {
+	w, err := scanWorker(DB.QueryRow(workerSelect+` WHERE w.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения воркера: %v", err)
+	}
+	return w, nil
+}
+
+func GetAllWorkers() ([]Worker, error) {
+	rows, err := DB.Query(workerSelect + ` ORDER BY w.id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса воркеров: %v", err)
+	}
+	defer rows.Close()
+
+	var workers []Worker
+	for rows.Next() {
+		w, err := scanWorker(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования воркера: %v", err)
+		}
+		workers = append(workers, *w)
+	}
+	return workers, rows.Err()
+}
+
+func TouchWorker(id int) error {
+	_, err := DB.Exec(`
+UPDATE workers SET last_heartbeat = now(), status = $2 WHERE id = $1
+`, id, WorkerOnline)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления воркера %d: %v", id, err)
+	}
+	return nil
+}
+
+// JobsToStop возвращает те из заданий running, которые воркер должен остановить:
+// они больше не выполняются или переданы другому исполнителю.
+func JobsToStop(workerID int, running []int) ([]int, error) {
+	if len(running) == 0 {
+		return nil, nil
+	}
+	rows, err := DB.Query(`
+SELECT r.id FROM unnest($2::int[]) AS r(id)
+LEFT JOIN jobs j ON j.id = r.id
+WHERE j.id IS NULL OR j.status <> $3 OR j.worker_id IS DISTINCT FROM $1
+`, workerID, pq.Array(running), JobRunning)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки заданий воркера: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MissingWorkerJobs возвращает задания, которые числятся выполняющимися на
+// воркере, но отсутствуют в присланном им списке running, например если
+// воркер не смог сообщить об их завершении. Задания, выданные позже чем grace
+// назад, пропускаются: воркер мог ещё не получить ответ на lease.
+func MissingWorkerJobs(workerID int, running []int, grace time.Duration) ([]*Job, error) {
+	rows, err := DB.Query(`
+SELECT `+jobColumns+` FROM jobs
+WHERE worker_id = $1 AND status = $2 AND NOT (id = ANY(COALESCE($3::int[], '{}')))
+  AND started_at < now() - make_interval(secs => $4)
+`, workerID, JobRunning, pq.Array(running), grace.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки заданий воркера: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования задания: %v", err)
+		}
+		list = append(list, j)
+	}
+	return list, rows.Err()
+}
+
+// MarkLostWorkers помечает потерянными воркеры без heartbeat дольше timeout.
+func MarkLostWorkers(timeout time.Duration) ([]int, error) {
+	rows, err := DB.Query(`
+UPDATE workers SET status = $1
+WHERE status = $2 AND last_heartbeat < now() - make_interval(secs => $3)
+RETURNING id
+`, WorkerLost, WorkerOnline, timeout.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска потерянных воркеров: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func RequeueWorkerJobs(workerID int, reason string) error {
+	rows, err := DB.Query(`SELECT id FROM jobs WHERE worker_id = $1 AND status = $2`, workerID, JobRunning)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса заданий воркера %d: %v", workerID, err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := RequeueJob(id, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Client — минимальный клиент Docker Engine API.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// APIError описывает ответ Docker Engine с кодом ошибки.
+type APIError struct {
+	Op         string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker %s: %d %s", e.Op, e.StatusCode, e.Message)
+}
+
+// IsUnavailable сообщает, что запрос не дошёл до Docker Engine или тот
+// ответил 503, то есть запрос стоит повторить позже.
+func IsUnavailable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusServiceUnavailable
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// IsNotFound сообщает, что Docker Engine ответил 404, в том числе когда
+// ошибка обёрнута вызывающим кодом.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный адрес Docker %q: %v", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport}, baseURL: "http://docker"}, nil
+	case "tcp", "http":
+		return &Client{http: &http.Client{}, baseURL: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемая схема Docker %q", u.Scheme)
+	}
+}
+
+type ContainerConfig struct {
+	Image      string            `json:"Image"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	Env        []string          `json:"Env,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+	HostConfig HostConfig        `json:"HostConfig"`
+}
+
+type HostConfig struct {
+	Binds      []string `json:"Binds,omitempty"`
+	NanoCPUs   int64    `json:"NanoCpus,omitempty"`
+	Memory     int64    `json:"Memory,omitempty"`
+	MemorySwap int64    `json:"MemorySwap,omitempty"`
+}
+
+type createResponse struct {
+	ID       string   `json:"Id"`
+	Warnings []string `json:"Warnings"`
+}
+
+// CreateContainer создаёт контейнер и возвращает его ID.
+func (c *Client) CreateContainer(ctx context.Context, name string, cfg ContainerConfig) (string, error) {
+	q := url.Values{}
+	if name != "" {
+		q.Set("name", name)
+	}
+	var resp createResponse
+	if err := c.do(ctx, "create", http.MethodPost, "/containers/create", q, cfg, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.do(ctx, "start", http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// WaitContainer ждёт остановки контейнера и возвращает его код выхода.
+func (c *Client) WaitContainer(ctx context.Context, id string) (int, error) {
+	var resp struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if err := c.do(ctx, "wait", http.MethodPost, "/containers/"+id+"/wait", nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Error != nil && resp.Error.Message != "" {
+		return resp.StatusCode, &APIError{Op: "wait", StatusCode: http.StatusOK, Message: resp.Error.Message}
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Client) RemoveContainer(ctx context.Context, id string, force bool) error {
+	q := url.Values{}
+	if force {
+		q.Set("force", "1")
+	}
+	return c.do(ctx, "remove", http.MethodDelete, "/containers/"+id, q, nil, nil)
+}
+
+// ContainerSummary — элемент списка контейнеров.
+type ContainerSummary struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+	State  string            `json:"State"`
+}
+
+// ListContainers возвращает все контейнеры с указанными метками, включая остановленные.
+func (c *Client) ListContainers(ctx context.Context, labels map[string]string) ([]ContainerSummary, error) {
+	filter := make([]string, 0, len(labels))
+	for k, v := range labels {
+		filter = append(filter, k+"="+v)
+	}
+	raw, err := json.Marshal(map[string][]string{"label": filter})
+	if err != nil {
+		return nil, fmt.Errorf("docker list: %v", err)
+	}
+	q := url.Values{}
+	q.Set("all", "1")
+	q.Set("filters", string(raw))
+	var resp []ContainerSummary
+	if err := c.do(ctx, "list", http.MethodGet, "/containers/json", q, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+type ContainerState struct {
+	Status     string `json:"Status"`
+	Running    bool   `json:"Running"`
+	OOMKilled  bool   `json:"OOMKilled"`
+	ExitCode   int    `json:"ExitCode"`
+	StartedAt  string `json:"StartedAt"`
+	FinishedAt string `json:"FinishedAt"`
+}
+
+type ContainerInfo struct {
+	ID    string         `json:"Id"`
+	Name  string         `json:"Name"`
+	State ContainerState `json:"State"`
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (*ContainerInfo, error) {
+	var resp ContainerInfo
+	if err := c.do(ctx, "inspect", http.MethodGet, "/containers/"+id+"/json", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) do(ctx context.Context, op, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.request(ctx, op, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("docker %s: ошибка разбора ответа: %v", op, err)
+	}
+	return nil
+}
+
+// request выполняет запрос и возвращает тело ответа при успешном статусе.
+// Закрыть тело должен вызывающий.
+func (c *Client) request(ctx context.Context, op, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		// Поток передаётся как есть: так в /build уходит tar-архив контекста.
+		reader = b
+		contentType = "application/x-tar"
+	default:
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("docker %s: ошибка сериализации запроса: %v", op, err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, fmt.Errorf("docker %s: %v", op, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker %s: %w", op, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(op, resp)
+	}
+	return resp, nil
+}
+
+func decodeAPIError(op string, resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var payload struct {
+		Message string `json:"message"`
+	}
+	msg := strings.TrimSpace(string(raw))
+	if err := json.Unmarshal(raw, &payload); err == nil && payload.Message != "" {
+		msg = payload.Message
+	}
+	return &APIError{Op: op, StatusCode: resp.StatusCode, Message: msg}
+}
+
+// ContainerLogs возвращает поток stdout/stderr контейнера без служебных заголовков.
+func (c *Client) ContainerLogs(ctx context.Context, id string, follow bool, tail string) (io.ReadCloser, error) {
+	q := url.Values{}
+	q.Set("stdout", "1")
+	q.Set("stderr", "1")
+	if follow {
+		q.Set("follow", "1")
+	}
+	if tail != "" {
+		q.Set("tail", tail)
+	}
+	resp, err := c.request(ctx, "logs", http.MethodGet, "/containers/"+id+"/logs", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Контейнеры создаются без TTY, поэтому поток всегда мультиплексирован.
+	pr, pw := io.Pipe()
+	go func() {
+		defer resp.Body.Close()
+		pw.CloseWithError(demux(pw, resp.Body))
+	}()
+	return pr, nil
+}
+
+// demux разбирает мультиплексированный поток логов: каждый кадр начинается
+// с 8-байтового заголовка, в последних четырёх байтах которого длина кадра.
+func demux(dst io.Writer, src io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(dst, src, size); err != nil {
+			return err
+		}
+	}
+}
+
+type ImageSummary struct {
+	ID       string            `json:"Id"`
+	RepoTags []string          `json:"RepoTags"`
+	Labels   map[string]string `json:"Labels"`
+	Created  int64             `json:"Created"`
+	Size     int64             `json:"Size"`
+}
+
+// ImageInfo — часть ответа /images/{name}/json.
+type ImageInfo struct {
+	ID          string   `json:"Id"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+func (c *Client) InspectImage(ctx context.Context, ref string) (*ImageInfo, error) {
+	var resp ImageInfo
+	if err := c.do(ctx, "inspect image", http.MethodGet, "/images/"+ref+"/json", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BuildImage отправляет tar-архив контекста в /build и возвращает поток
+// JSON-сообщений сборки. Закрыть поток должен вызывающий.
+func (c *Client) BuildImage(ctx context.Context, buildContext io.Reader, tags []string, labels map[string]string) (io.ReadCloser, error) {
+	q := url.Values{}
+	for _, t := range tags {
+		q.Add("t", t)
+	}
+	if len(labels) > 0 {
+		raw, err := json.Marshal(labels)
+		if err != nil {
+			return nil, fmt.Errorf("docker build: %v", err)
+		}
+		q.Set("labels", string(raw))
+	}
+	q.Set("rm", "1")
+	q.Set("forcerm", "1")
+	resp, err := c.request(ctx, "build", http.MethodPost, "/build", q, buildContext)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ListImages возвращает образы с указанными метками.
+func (c *Client) ListImages(ctx context.Context, labels map[string]string) ([]ImageSummary, error) {
+	filter := make([]string, 0, len(labels))
+	for k, v := range labels {
+		filter = append(filter, k+"="+v)
+	}
+	raw, err := json.Marshal(map[string][]string{"label": filter})
+	if err != nil {
+		return nil, fmt.Errorf("docker images: %v", err)
+	}
+	q := url.Values{}
+	q.Set("filters", string(raw))
+	var resp []ImageSummary
+	if err := c.do(ctx, "images", http.MethodGet, "/images/json", q, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) RemoveImage(ctx context.Context, ref string, force bool) error {
+	q := url.Values{}
+	if force {
+		q.Set("force", "1")
+	}
+	return c.do(ctx, "rmi", http.MethodDelete, "/images/"+ref, q, nil, nil)
+}
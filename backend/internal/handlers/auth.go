@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/axywe/distributed-benchmarks/internal/helpers"
 	"github.com/axywe/distributed-benchmarks/sessions"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type loginRequest struct {
@@ -152,3 +154,45 @@ func UserHandler(w http.ResponseWriter, r *http.Request) {
 
 	helpers.WriteJSONResponse(w, user, http.StatusOK)
 }
+
+// PUT /api/v1/users/{id}/weight
+//
+// Вес задаёт долю слотов пользователя при справедливом разделении очереди.
+func UpdateUserWeightHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Weight float64 `json:"weight"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Weight <= 0 {
+		helpers.WriteErrorResponse(w, "Вес должен быть положительным", http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateUserWeight(id, req.Weight); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := db.FindUserById(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+	user.Password = ""
+	helpers.WriteJSONResponse(w, user, http.StatusOK)
+}
+
+// currentUser возвращает пользователя по токену из заголовка Authorization.
+func currentUser(r *http.Request) (*db.User, error) {
+	userID, err := sessions.GetUserIDByToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	return db.FindUserById(userID)
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
+	"github.com/gorilla/mux"
+)
+
+// MaxBatchRuns ограничивает число прогонов в одном пакете.
+const MaxBatchRuns = 1000
+
+const (
+	BatchRunQueued  = "queued"
+	BatchRunCached  = "cached"
+	BatchRunInvalid = "invalid"
+)
+
+// BatchRun — итог постановки одного прогона пакета.
+type BatchRun struct {
+	Parameters map[string]interface{} `json:"parameters"`
+	Status     string                 `json:"status"`
+	JobID      int                    `json:"job_id,omitempty"`
+	ResultIDs  []string               `json:"result_ids,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	BatchID int        `json:"batch_id"`
+	Total   int        `json:"total"`
+	Queued  int        `json:"queued"`
+	Cached  int        `json:"cached"`
+	Invalid int        `json:"invalid"`
+	Runs    []BatchRun `json:"runs"`
+}
+
+// POST /api/v1/optimization/batch
+//
+// Значение любого параметра может быть списком [1, 2, 3] или диапазоном
+// {"from": 1, "to": 10, "step": 1}; прогоны строятся по декартову произведению.
+func OptimizationBatchHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	var spec map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка парсинга JSON", http.StatusBadRequest)
+		return
+	}
+	forceRun := popForceRun(spec)
+	budget, err := popBudget(spec)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	experimentID, err := popExperiment(spec, user.ID)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	combos, err := expandGrid(spec)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if forceRun {
+		spec["force_run"] = true
+	}
+	if budget > 0 {
+		spec["expected_budget"] = budget
+	}
+	batch := &db.Batch{UserID: user.ID, ExperimentID: experimentID, Kind: db.BatchGrid, Spec: spec}
+	resp, err := submitBatch(batch, combos, forceRun, budget)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, resp, http.StatusAccepted)
+}
+
+// submitBatch готовит каждый прогон так же, как одиночный запуск, и ставит
+// оставшиеся после поиска в кэше прогоны в очередь вместе с записью пакета.
+// Повторяющиеся наборы параметров ставятся один раз. Найденные в кэше
+// результаты привязываются к эксперименту пакета. budget — ожидаемый бюджет
+// каждого прогона, 0 — не указан.
+func submitBatch(batch *db.Batch, combos []map[string]interface{}, forceRun bool, budget int64) (*BatchResponse, error) {
+	combos = uniqueCombos(combos)
+	resp := &BatchResponse{Total: len(combos), Runs: make([]BatchRun, 0, len(combos))}
+	var queued []*db.Job
+	var queuedRuns []int
+	for _, params := range combos {
+		run := BatchRun{Parameters: params}
+		plan, err := planRun(params, batch.UserID, forceRun)
+		switch {
+		case err != nil:
+			if re, ok := err.(*runError); !ok || re.Status >= http.StatusInternalServerError {
+				return nil, err
+			}
+			run.Status = BatchRunInvalid
+			run.Error = err.Error()
+			resp.Invalid++
+		case plan.Cached:
+			if err := attachCached(batch.ExperimentID, plan.Matches); err != nil {
+				return nil, err
+			}
+			run.Status = BatchRunCached
+			for _, m := range plan.Matches {
+				run.ResultIDs = append(run.ResultIDs, m.ResultID)
+			}
+			resp.Cached++
+		default:
+			run.Status = BatchRunQueued
+			plan.Job.ExperimentID = batch.ExperimentID
+			plan.Job.Budget = budget
+			queued = append(queued, plan.Job)
+			queuedRuns = append(queuedRuns, len(resp.Runs))
+			resp.Queued++
+		}
+		resp.Runs = append(resp.Runs, run)
+	}
+
+	var check db.QuotaCheck
+	if len(queued) > 0 {
+		var err error
+		if check, err = quotaCheck(batch.UserID, queued); err != nil {
+			return nil, err
+		}
+	}
+	batch.Total = resp.Total
+	batch.Cached = resp.Cached
+	batch.Invalid = resp.Invalid
+	id, err := db.InsertBatch(batch, queued, check)
+	if err != nil {
+		return nil, err
+	}
+	for i, job := range queued {
+		resp.Runs[queuedRuns[i]].JobID = job.ID
+	}
+	for _, run := range resp.Runs {
+		if run.Status == BatchRunCached {
+			recordCacheHit(batch.UserID, id, batch.ExperimentID, run.ResultIDs)
+		}
+	}
+	resp.BatchID = id
+	if len(queued) > 0 {
+		jobs.Notify()
+	}
+	return resp, nil
+}
+
+// uniqueCombos убирает повторы, сохраняя первое вхождение. json.Marshal
+// сортирует ключи, поэтому одинаковые наборы дают одинаковую строку.
+func uniqueCombos(combos []map[string]interface{}) []map[string]interface{} {
+	seen := make(map[string]bool, len(combos))
+	unique := combos[:0]
+	for _, params := range combos {
+		if key, err := json.Marshal(params); err == nil {
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+		}
+		unique = append(unique, params)
+	}
+	return unique
+}
+
+// expandGrid разворачивает списки и диапазоны значений в декартово
+// произведение. Последний по алфавиту параметр меняется быстрее всех.
+func expandGrid(spec map[string]interface{}) ([]map[string]interface{}, error) {
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([][]interface{}, len(keys))
+	total := 1
+	for i, k := range keys {
+		vals, err := expandValues(k, spec[k])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = vals
+		total *= len(vals)
+		if total > MaxBatchRuns {
+			return nil, fmt.Errorf("пакет не может содержать больше %d прогонов", MaxBatchRuns)
+		}
+	}
+
+	combos := make([]map[string]interface{}, 0, total)
+	idx := make([]int, len(keys))
+	for {
+		params := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			params[k] = values[i][idx[i]]
+		}
+		combos = append(combos, params)
+
+		i := len(keys) - 1
+		for ; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < len(values[i]) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			return combos, nil
+		}
+	}
+}
+
+func expandValues(key string, raw interface{}) ([]interface{}, error) {
+	switch v := raw.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("пустой список значений для %s", key)
+		}
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("некорректное значение в списке %s", key)
+			}
+		}
+		return v, nil
+	case map[string]interface{}:
+		return expandRange(key, v)
+	default:
+		return []interface{}{v}, nil
+	}
+}
+
+// expandRange разворачивает {"from", "to", "step"} в значения от from до to включительно.
+func expandRange(key string, rng map[string]interface{}) ([]interface{}, error) {
+	from, okFrom := rng["from"].(float64)
+	to, okTo := rng["to"].(float64)
+	if !okFrom || !okTo {
+		return nil, fmt.Errorf("диапазон %s должен содержать числа from и to", key)
+	}
+	step := 1.0
+	if raw, ok := rng["step"]; ok {
+		s, ok := raw.(float64)
+		if !ok || s <= 0 {
+			return nil, fmt.Errorf("шаг диапазона %s должен быть положительным числом", key)
+		}
+		step = s
+	}
+	if to < from {
+		return nil, fmt.Errorf("в диапазоне %s from больше to", key)
+	}
+	// Число значений проверяется до перевода в int: при крошечном шаге или
+	// огромном диапазоне частное бесконечно или не помещается в int.
+	count := math.Floor((to-from)/step+1e-9) + 1
+	if math.IsNaN(count) || math.IsInf(count, 0) || count > MaxBatchRuns {
+		return nil, fmt.Errorf("пакет не может содержать больше %d прогонов", MaxBatchRuns)
+	}
+	vals := make([]interface{}, int(count))
+	for i := range vals {
+		// Округление убирает хвосты вроде 0.30000000000000004.
+		vals[i] = math.Round((from+float64(i)*step)*1e9) / 1e9
+	}
+	return vals, nil
+}
+
+// GET /api/v1/optimization/batches?limit={limit}&offset={offset}
+func UserBatchesHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	vars := r.URL.Query()
+	limit, err := strconv.Atoi(vars.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(vars.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	list, err := db.GetBatchesByUser(user.ID, limit, offset)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+// GET /api/v1/optimization/batches/{id}
+func BatchStatusHandler(w http.ResponseWriter, r *http.Request) {
+	batch, ok := loadBatch(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	batch.Jobs, err = db.GetBatchJobs(batch.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	batch.Counts = make(map[string]int)
+	for _, j := range batch.Jobs {
+		batch.Counts[j.Status]++
+	}
+	helpers.WriteJSONResponse(w, batch, http.StatusOK)
+}
+
+// DELETE /api/v1/optimization/batches/{id}
+func CancelBatchHandler(w http.ResponseWriter, r *http.Request) {
+	batch, ok := loadBatch(w, r)
+	if !ok {
+		return
+	}
+	user, _ := currentUser(r)
+	list, err := db.GetBatchJobs(batch.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cancelled := 0
+	for i := range list {
+		job := &list[i]
+		if job.Status != db.JobQueued && job.Status != db.JobRunning {
+			continue
+		}
+		ok, err := jobs.Default.Cancel(r.Context(), job, fmt.Sprintf("пакет %d отменён пользователем %s", batch.ID, user.Login))
+		if err != nil {
+			helpers.WriteErrorResponse(w, "Ошибка отмены задания: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			cancelled++
+		}
+	}
+	helpers.WriteJSONResponse(w, map[string]int{"cancelled": cancelled}, http.StatusOK)
+}
+
+// loadBatch загружает пакет из пути запроса; доступ есть у владельца и администраторов.
+func loadBatch(w http.ResponseWriter, r *http.Request) (*db.Batch, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID пакета", http.StatusBadRequest)
+		return nil, false
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return nil, false
+	}
+	batch, err := db.GetBatch(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if batch == nil {
+		helpers.WriteErrorResponse(w, "Пакет не найден", http.StatusNotFound)
+		return nil, false
+	}
+	if batch.UserID != user.ID && user.Group != "admin" {
+		helpers.WriteErrorResponse(w, "Недостаточно прав", http.StatusForbidden)
+		return nil, false
+	}
+	return batch, true
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		rng     map[string]interface{}
+		want    []interface{}
+		wantErr bool
+	}{
+		{"default step", map[string]interface{}{"from": 1.0, "to": 3.0}, []interface{}{1.0, 2.0, 3.0}, false},
+		{"fractional step", map[string]interface{}{"from": 0.0, "to": 0.3, "step": 0.1}, []interface{}{0.0, 0.1, 0.2, 0.3}, false},
+		{"single value", map[string]interface{}{"from": 2.0, "to": 2.0}, []interface{}{2.0}, false},
+		{"from above to", map[string]interface{}{"from": 3.0, "to": 1.0}, nil, true},
+		{"zero step", map[string]interface{}{"from": 0.0, "to": 1.0, "step": 0.0}, nil, true},
+		{"missing to", map[string]interface{}{"from": 0.0}, nil, true},
+		{"too many values", map[string]interface{}{"from": 0.0, "to": float64(MaxBatchRuns)}, nil, true},
+		{"tiny step", map[string]interface{}{"from": 0.0, "to": 1.0, "step": 1e-300}, nil, true},
+		{"huge span", map[string]interface{}{"from": -1e308, "to": 1e308}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandRange("x", tt.rng)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandRange error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandRange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
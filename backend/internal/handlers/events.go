@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+)
+
+const (
+	eventPollInterval = time.Second
+	eventKeepAlive    = 15 * time.Second
+	eventPageSize     = 100
+)
+
+var (
+	eventsDone      = make(chan struct{})
+	closeEventsOnce sync.Once
+)
+
+// CloseEventStreams завершает открытые потоки событий. http.Server.Shutdown
+// не отменяет контексты запросов и без этого ждал бы каждый поток до таймаута,
+// поэтому сервер вызывает её через RegisterOnShutdown.
+func CloseEventStreams() {
+	closeEventsOnce.Do(func() { close(eventsDone) })
+}
+
+// GET /api/v1/events?last_event_id={id}
+//
+// Поток событий заданий пользователя в формате text/event-stream; администратор
+// получает события всех пользователей. Чтобы продолжить поток после разрыва,
+// id последнего события передаётся в заголовке Last-Event-ID или в
+// last_event_id. Без них поток начинается с новых событий. События идут в
+// порядке фиксации транзакций, поэтому их id не обязательно возрастают.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Поток не поддерживает флешинг", http.StatusInternalServerError)
+		return
+	}
+
+	raw := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	var after db.EventCursor
+	if raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 0 {
+			helpers.WriteErrorResponse(w, "Некорректный Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		after, err = db.EventCursorAt(id)
+	} else {
+		after, err = db.CurrentEventCursor()
+	}
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scope := user.ID
+	if user.Group == "admin" {
+		scope = 0
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for r.Context().Err() == nil {
+		events, err := db.GetUserEvents(scope, after, eventPageSize)
+		if err != nil {
+			log.Printf("%v", err)
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			flusher.Flush()
+			return
+		}
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Ошибка сериализации события %d: %v", e.ID, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			after = e.Cursor()
+		}
+		switch {
+		case len(events) > 0:
+			flusher.Flush()
+			lastWrite = time.Now()
+		case time.Since(lastWrite) >= eventKeepAlive:
+			// Комментарий не даёт прокси закрыть простаивающее соединение.
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+		if len(events) == eventPageSize {
+			continue
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-eventsDone:
+			return
+		case <-ticker.C:
+		}
+	}
+}
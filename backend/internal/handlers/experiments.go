@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/gorilla/mux"
+)
+
+type ExperimentRequest struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Tags        []string `json:"tags"`
+	Archived    *bool    `json:"archived"`
+}
+
+// POST /api/v1/experiments
+func CreateExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	var req ExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	e := &db.Experiment{UserID: user.ID}
+	applyExperimentRequest(e, req)
+	if e.Name == "" {
+		helpers.WriteErrorResponse(w, "Не указано название эксперимента", http.StatusBadRequest)
+		return
+	}
+	id, err := db.InsertExperiment(e)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created, err := db.GetExperiment(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, created, http.StatusCreated)
+}
+
+// GET /api/v1/experiments?archived={true|false}&tag={tag}
+func ListExperimentsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	archived, _ := strconv.ParseBool(r.URL.Query().Get("archived"))
+	list, err := db.GetExperimentsByUser(user.ID, archived, r.URL.Query().Get("tag"))
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+// GET /api/v1/experiments/{id}
+func GetExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadExperiment(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	e.Jobs, err = db.GetExperimentJobCounts(e.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, e, http.StatusOK)
+}
+
+// PUT /api/v1/experiments/{id}
+//
+// Меняет только переданные поля: название, описание, теги и признак архива.
+func UpdateExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadExperiment(w, r)
+	if !ok {
+		return
+	}
+	var req ExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	applyExperimentRequest(e, req)
+	if e.Name == "" {
+		helpers.WriteErrorResponse(w, "Название эксперимента не может быть пустым", http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateExperiment(e); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated, err := db.GetExperiment(e.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, updated, http.StatusOK)
+}
+
+// POST /api/v1/experiments/{id}/results
+func AttachExperimentResultsHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadExperiment(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ResultIDs []string `json:"result_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ResultIDs) == 0 {
+		helpers.WriteErrorResponse(w, "Не указаны result_ids", http.StatusBadRequest)
+		return
+	}
+	if err := db.AttachExperimentResults(e.ID, req.ResultIDs); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated, err := db.GetExperiment(e.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, updated, http.StatusOK)
+}
+
+// GET /api/v1/experiments/{id}/export?format={csv|json}
+func ExportExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadExperiment(w, r)
+	if !ok {
+		return
+	}
+	ids, err := db.GetExperimentResultIDs(e.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results := make([]db.OptimizationResult, 0, len(ids))
+	for _, id := range ids {
+		res, err := db.LoadOptimizationResult(id)
+		if err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, res)
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "json":
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=experiment-%d.json", e.ID))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(results)
+	case "", "csv":
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=experiment-%d.csv", e.ID))
+		w.Header().Set("Content-Type", "text/csv")
+		writeResultsCSV(w, results)
+	default:
+		helpers.WriteErrorResponse(w, "Неизвестный формат экспорта", http.StatusBadRequest)
+	}
+}
+
+// writeResultsCSV пишет по строке на результат; столбцы параметров — объединение
+// параметров всех результатов.
+func writeResultsCSV(w http.ResponseWriter, results []db.OptimizationResult) {
+	paramSet := make(map[string]bool)
+	for _, res := range results {
+		for name := range res.Parameters {
+			paramSet[name] = true
+		}
+	}
+	params := make([]string, 0, len(paramSet))
+	for name := range paramSet {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+
+	cw := csv.NewWriter(w)
+	header := []string{"result_id", "algorithm_name", "algorithm_version", "image_digest", "source_hash", "run_version", "expected_budget", "actual_budget", "best_f", "best_objectives", "best_x"}
+	_ = cw.Write(append(header, params...))
+	for _, res := range results {
+		var xs []string
+		for i := 0; ; i++ {
+			x, ok := res.BestResult[fmt.Sprintf("x[%d]", i)]
+			if !ok {
+				break
+			}
+			xs = append(xs, strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		var fs []string
+		for i := 1; ; i++ {
+			f, ok := res.BestResult[fmt.Sprintf("f[%d]", i)]
+			if !ok {
+				break
+			}
+			fs = append(fs, strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		row := []string{
+			res.ResultID,
+			res.AlgorithmName,
+			res.AlgorithmVersion,
+			res.ImageDigest,
+			res.SourceHash,
+			res.RunVersion,
+			strconv.Itoa(res.ExpectedBudget),
+			strconv.Itoa(res.ActualBudget),
+			strconv.FormatFloat(res.BestResult["f[1]"], 'g', -1, 64),
+			strings.Join(fs, ";"),
+			strings.Join(xs, ";"),
+		}
+		for _, name := range params {
+			v, ok := res.Parameters[name]
+			if !ok || v == nil {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, fmt.Sprint(v))
+		}
+		_ = cw.Write(row)
+	}
+	cw.Flush()
+}
+
+func applyExperimentRequest(e *db.Experiment, req ExperimentRequest) {
+	if req.Name != nil {
+		e.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		e.Description = *req.Description
+	}
+	if req.Tags != nil {
+		e.Tags = req.Tags
+	}
+	if req.Archived != nil {
+		e.Archived = *req.Archived
+	}
+}
+
+// loadExperiment загружает эксперимент из пути запроса; доступ есть у владельца и администраторов.
+func loadExperiment(w http.ResponseWriter, r *http.Request) (*db.Experiment, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID эксперимента", http.StatusBadRequest)
+		return nil, false
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return nil, false
+	}
+	e, err := experimentFor(user, id)
+	if err != nil {
+		writeRunError(w, err)
+		return nil, false
+	}
+	return e, true
+}
+
+func experimentFor(user *db.User, id int) (*db.Experiment, error) {
+	e, err := db.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, &runError{http.StatusNotFound, "Эксперимент не найден"}
+	}
+	if e.UserID != user.ID && user.Group != "admin" {
+		return nil, &runError{http.StatusForbidden, "Недостаточно прав для доступа к эксперименту"}
+	}
+	return e, nil
+}
+
+// scopeExperiment проверяет experiment_id из строки запроса, которым
+// ограничивают выдачу результатов.
+func scopeExperiment(r *http.Request, raw string) (*db.Experiment, error) {
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, &runError{http.StatusBadRequest, "Неверный ID эксперимента"}
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		return nil, &runError{http.StatusUnauthorized, "Ошибка авторизации"}
+	}
+	return experimentFor(user, id)
+}
+
+// experimentForRun проверяет, что пользователь может ставить прогоны в эксперимент.
+func experimentForRun(userId, id int) (*db.Experiment, error) {
+	if userId == 0 {
+		return nil, &runError{http.StatusUnauthorized, "Для запуска в эксперименте нужна авторизация"}
+	}
+	e, err := db.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, &runError{http.StatusNotFound, "Эксперимент не найден"}
+	}
+	if e.UserID != userId {
+		return nil, &runError{http.StatusForbidden, "Недостаточно прав для доступа к эксперименту"}
+	}
+	if e.Archived {
+		return nil, &runError{http.StatusConflict, "Эксперимент находится в архиве"}
+	}
+	return e, nil
+}
+
+// popExperiment извлекает experiment_id из параметров запроса.
+// Возвращает 0, если прогон не относится к эксперименту.
+func popExperiment(inputArgs map[string]interface{}, userId int) (int, error) {
+	raw, ok := inputArgs["experiment_id"]
+	if !ok {
+		return 0, nil
+	}
+	delete(inputArgs, "experiment_id")
+	id, ok := raw.(float64)
+	if !ok {
+		return 0, &runError{http.StatusBadRequest, "Некорректный тип для experiment_id"}
+	}
+	e, err := experimentForRun(userId, int(id))
+	if err != nil {
+		return 0, err
+	}
+	return e.ID, nil
+}
+
+// attachCached привязывает найденные в кэше результаты к эксперименту прогона.
+func attachCached(experimentID int, matches []db.OptimizationResult) error {
+	if experimentID == 0 || len(matches) == 0 {
+		return nil
+	}
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ResultID
+	}
+	return db.AttachExperimentResults(experimentID, ids)
+}
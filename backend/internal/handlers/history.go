@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultHistoryLimit      = 1000
+	maxHistoryLimit          = 10000
+	defaultConvergencePoints = 100
+	maxConvergencePoints     = 1000
+	maxConvergenceResults    = 1000
+)
+
+type ConvergenceRequest struct {
+	ResultIDs []string `json:"result_ids"`
+	Points    int      `json:"points"`
+	Scale     string   `json:"scale"`
+}
+
+// ConvergenceResponse содержит кривые в порядке запроса. В Missing попадают
+// результаты без загруженной истории.
+type ConvergenceResponse struct {
+	Traces  []db.ConvergenceTrace `json:"traces"`
+	Missing []string              `json:"missing"`
+}
+
+// GET /api/v1/optimization/results/{id}/history?offset={offset}&limit={limit}
+func ResultHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+	offset, err := strconv.Atoi(vars.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	limit, err := strconv.Atoi(vars.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	page, err := db.GetHistory(mux.Vars(r)["id"], offset, limit)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if page == nil {
+		helpers.WriteErrorResponse(w, "История результата не найдена", http.StatusNotFound)
+		return
+	}
+	helpers.WriteJSONResponse(w, page, http.StatusOK)
+}
+
+// POST /api/v1/optimization/convergence
+//
+// Возвращает лучшее найденное значение f[1] по бюджетам для каждого из
+// result_ids. scale — log (по умолчанию) или linear, points — число бюджетов.
+func ConvergenceHandler(w http.ResponseWriter, r *http.Request) {
+	var req ConvergenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.ResultIDs) == 0 {
+		helpers.WriteErrorResponse(w, "Нужен хотя бы один result_id", http.StatusBadRequest)
+		return
+	}
+	if len(req.ResultIDs) > maxConvergenceResults {
+		helpers.WriteErrorResponse(w, "Слишком много результатов в одном запросе", http.StatusBadRequest)
+		return
+	}
+	writeConvergence(w, req.ResultIDs, req.Points, req.Scale)
+}
+
+// GET /api/v1/experiments/{id}/convergence?points={points}&scale={log|linear}
+func ExperimentConvergenceHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadExperiment(w, r)
+	if !ok {
+		return
+	}
+	ids, err := db.GetExperimentResultIDs(e.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	points, _ := strconv.Atoi(r.URL.Query().Get("points"))
+	writeConvergence(w, ids, points, r.URL.Query().Get("scale"))
+}
+
+func writeConvergence(w http.ResponseWriter, resultIDs []string, points int, scale string) {
+	if points <= 0 {
+		points = defaultConvergencePoints
+	}
+	if points > maxConvergencePoints {
+		points = maxConvergencePoints
+	}
+	var logScale bool
+	switch scale {
+	case "", "log":
+		logScale = true
+	case "linear":
+	default:
+		helpers.WriteErrorResponse(w, "scale должен быть log или linear", http.StatusBadRequest)
+		return
+	}
+
+	histories, err := db.GetObjectiveHistories(resultIDs)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := ConvergenceResponse{Traces: []db.ConvergenceTrace{}, Missing: []string{}}
+	seen := make(map[string]bool, len(resultIDs))
+	for _, id := range resultIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		f, ok := histories[id]
+		if !ok {
+			resp.Missing = append(resp.Missing, id)
+			continue
+		}
+		resp.Traces = append(resp.Traces, db.Convergence(id, f, points, logScale))
+	}
+	helpers.WriteJSONResponse(w, resp, http.StatusOK)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/docker"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+	"github.com/gorilla/mux"
+)
+
+// ImageInfo — образ метода; Current отмечает образ, с которым сейчас идут прогоны метода.
+type ImageInfo struct {
+	runner.Image
+	Current bool `json:"current"`
+}
+
+// POST /api/v1/methods/{id}/build
+//
+// Лог сборки передаётся как text/event-stream. Последнее событие — finish
+// с тегом образа или error с текстом ошибки.
+func BuildMethodImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID метода", http.StatusBadRequest)
+		return
+	}
+	builder, ok := imageBuilder(w)
+	if !ok {
+		return
+	}
+	method, err := db.GetOptimizationMethodByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.WriteErrorResponse(w, "Метод не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка загрузки метода: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	source, target, err := methodSource(method)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Поток не поддерживает флешинг", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	tag, err := builder.BuildImage(r.Context(), runner.ImageBuild{
+		MethodID: method.ID,
+		Source:   source,
+		Target:   target,
+	}, func(line string) {
+		fmt.Fprintf(w, "data: %s\n\n", line)
+		flusher.Flush()
+	})
+	if err == nil {
+		err = db.UpdateOptimizationMethodImage(method.ID, tag)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	} else {
+		fmt.Fprintf(w, "event: finish\ndata: %s\n\n", tag)
+	}
+	flusher.Flush()
+}
+
+// GET /api/v1/images
+func ListImagesHandler(w http.ResponseWriter, r *http.Request) {
+	builder, ok := imageBuilder(w)
+	if !ok {
+		return
+	}
+	images, err := builder.Images(r.Context())
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	methods, err := db.GetAllOptimizationMethods()
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	current := make(map[string]bool)
+	for _, m := range methods {
+		if m.Image != "" {
+			current[m.Image] = true
+		}
+	}
+	out := make([]ImageInfo, len(images))
+	for i, img := range images {
+		out[i] = ImageInfo{Image: img}
+		for _, t := range img.Tags {
+			if current[t] {
+				out[i].Current = true
+			}
+		}
+	}
+	helpers.WriteJSONResponse(w, out, http.StatusOK)
+}
+
+// DELETE /api/v1/images/{ref}
+//
+// ref — ID или тег образа. Методы, которые шли в удалённом образе,
+// возвращаются к образу по умолчанию.
+func DeleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	ref := mux.Vars(r)["ref"]
+	builder, ok := imageBuilder(w)
+	if !ok {
+		return
+	}
+	images, err := builder.Images(r.Context())
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tags := []string{ref}
+	for _, img := range images {
+		if img.ID == ref || strings.TrimPrefix(img.ID, "sha256:") == ref {
+			tags = append(tags, img.Tags...)
+		}
+	}
+
+	if err := builder.RemoveImage(r.Context(), ref); err != nil {
+		status := http.StatusInternalServerError
+		var apiErr *docker.APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusConflict) {
+			status = apiErr.StatusCode
+		}
+		helpers.WriteErrorResponse(w, "Ошибка удаления образа: "+err.Error(), status)
+		return
+	}
+	if err := db.ClearOptimizationMethodImages(tags); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"message": "Образ удалён"}, http.StatusOK)
+}
+
+func imageBuilder(w http.ResponseWriter) (runner.ImageBuilder, bool) {
+	builder, ok := runner.Default.(runner.ImageBuilder)
+	if !ok {
+		helpers.WriteErrorResponse(w, "Образы методов доступны только с Docker-раннером", http.StatusNotImplemented)
+	}
+	return builder, ok
+}
+
+// methodSource находит файлы пользовательского метода в bench/custom и
+// путь, по которому их ожидает run.py внутри образа.
+func methodSource(method *db.OptimizationMethod) (string, string, error) {
+	if !strings.HasPrefix(method.Name, insertPrefix) {
+		return "", "", fmt.Errorf("образ собирается только для пользовательских методов")
+	}
+	rel := method.FilePath
+	if rel == "" {
+		rel = strings.ReplaceAll(strings.TrimPrefix(method.Name, insertPrefix), ".", "/")
+	}
+	rel = filepath.Clean(rel)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("некорректный путь к файлам метода")
+	}
+	for _, candidate := range []string{rel, rel + ".py"} {
+		if _, err := os.Stat(filepath.Join(basePath, candidate)); err == nil {
+			return filepath.Join(basePath, candidate), filepath.Join("custom", candidate), nil
+		}
+	}
+	return "", "", fmt.Errorf("файлы метода %s не найдены в %s", method.Name, basePath)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
+	"github.com/axywe/distributed-benchmarks/sessions"
+	"github.com/gorilla/mux"
+)
+
+// GET /api/v1/optimization/jobs/{id}?tolerance={tolerance}
+func JobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID задания", http.StatusBadRequest)
+		return
+	}
+	tol, ok := rerunTolerance(w, r)
+	if !ok {
+		return
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	job, err := db.GetJobByID(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil || (job.UserID != user.ID && user.Group != "admin") {
+		helpers.WriteErrorResponse(w, "Задание не найдено", http.StatusNotFound)
+		return
+	}
+	job.Events, err = db.GetJobEvents(job.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job.Attempts, err = db.GetJobAttempts(job.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := jobs.Default.Estimate(job); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := compareRerun(job, tol); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, job, http.StatusOK)
+}
+
+// GET /api/v1/optimization/jobs?status={status}&limit={limit}&offset={offset}
+func UserJobsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := sessions.GetUserIDByToken(r.Header.Get("Authorization"))
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	vars := r.URL.Query()
+	limit, err := strconv.Atoi(vars.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(vars.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	list, err := db.GetJobsByUser(userId, limit, offset, vars.Get("status"))
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+// DELETE /api/v1/optimization/jobs/{id}
+func CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID задания", http.StatusBadRequest)
+		return
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	job, err := db.GetJobByID(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		helpers.WriteErrorResponse(w, "Задание не найдено", http.StatusNotFound)
+		return
+	}
+	if job.UserID != user.ID && user.Group != "admin" {
+		helpers.WriteErrorResponse(w, "Недостаточно прав для отмены задания", http.StatusForbidden)
+		return
+	}
+
+	cancelled, err := jobs.Default.Cancel(r.Context(), job, "отменено пользователем "+user.Login)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка отмены задания: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !cancelled {
+		helpers.WriteErrorResponse(w, "Задание уже завершено", http.StatusConflict)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"message": "Задание отменено"}, http.StatusOK)
+}
@@ -28,12 +28,14 @@ func CreateOptimizationMethodHandler(w http.ResponseWriter, r *http.Request) {
 		Name       string                                `json:"name"`
 		Parameters map[string]db.OptimizationMethodParam `json:"parameters"`
 		FilePath   string                                `json:"file_path"`
+		Limits     db.ResourceLimits                     `json:"limits"`
+		Retry      db.RetryPolicy                        `json:"retry_policy"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
 		return
 	}
-	id, err := db.InsertOptimizationMethod(insertPrefix+req.Name, req.Parameters, req.FilePath)
+	id, err := db.InsertOptimizationMethod(insertPrefix+req.Name, req.Parameters, req.FilePath, req.Limits, req.Retry)
 	if err != nil {
 		helpers.WriteErrorResponse(w, "Ошибка создания метода: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -60,3 +62,59 @@ func DeleteOptimizationMethodHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	helpers.WriteJSONResponse(w, map[string]string{"message": "Метод удалён"}, http.StatusOK)
 }
+
+// PUT /api/v1/methods/{id}/limits
+func UpdateOptimizationMethodLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID метода", http.StatusBadRequest)
+		return
+	}
+	var limits db.ResourceLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if limits.CPUs < 0 || limits.MemoryMB < 0 || limits.TimeoutSeconds < 0 {
+		helpers.WriteErrorResponse(w, "Лимиты не могут быть отрицательными", http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateOptimizationMethodLimits(id, limits); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	method, err := db.GetOptimizationMethodByID(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	helpers.WriteJSONResponse(w, method, http.StatusOK)
+}
+
+// PUT /api/v1/methods/{id}/retry
+func UpdateOptimizationMethodRetryPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID метода", http.StatusBadRequest)
+		return
+	}
+	var retry db.RetryPolicy
+	if err := json.NewDecoder(r.Body).Decode(&retry); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if retry.MaxAttempts < 0 || retry.BackoffSeconds < 0 || retry.MaxBackoffSeconds < 0 {
+		helpers.WriteErrorResponse(w, "Параметры повторов не могут быть отрицательными", http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateOptimizationMethodRetryPolicy(id, retry); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	method, err := db.GetOptimizationMethodByID(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	helpers.WriteJSONResponse(w, method, http.StatusOK)
+}
@@ -2,21 +2,26 @@ package handlers
 
 import (
 	"bufio"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/axywe/distributed-benchmarks/internal/db"
 	"github.com/axywe/distributed-benchmarks/internal/helpers"
-	"github.com/axywe/distributed-benchmarks/internal/utils"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
 	"github.com/axywe/distributed-benchmarks/sessions"
 	"github.com/gorilla/mux"
 )
@@ -31,7 +36,9 @@ type OptimizationRequest struct {
 type OptimizationPostResponse struct {
 	Cached        bool                    `json:"cached"`
 	Matches       []db.OptimizationResult `json:"matches,omitempty"`
+	JobID         int                     `json:"job_id,omitempty"`
 	ContainerName string                  `json:"container_name,omitempty"`
+	ResultID      string                  `json:"result_id,omitempty"`
 }
 
 // POST /api/v1/optimization
@@ -47,58 +54,192 @@ func OptimizationPostHandler(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteErrorResponse(w, "Ошибка парсинга JSON", http.StatusBadRequest)
 		return
 	}
-
-	forceRun := false
-	if force, ok := inputArgs["force_run"]; ok {
-		if b, ok := force.(bool); ok && b {
-			forceRun = true
-		}
-		delete(inputArgs, "force_run")
+	forceRun := popForceRun(inputArgs)
+	budget, err := popBudget(inputArgs)
+	if err != nil {
+		writeRunError(w, err)
+		return
 	}
 
-	rawAlgo, ok := inputArgs["algorithm"]
-	if !ok {
-		helpers.WriteErrorResponse(w, "Не указан параметр algorithm", http.StatusBadRequest)
+	userId, _ := sessions.GetUserIDByToken(r.Header.Get("Authorization"))
+	experimentID, err := popExperiment(inputArgs, userId)
+	if err != nil {
+		writeRunError(w, err)
 		return
 	}
-	algoFloat, ok := rawAlgo.(float64)
-	if !ok {
-		helpers.WriteErrorResponse(w, "Некорректный тип для algorithm", http.StatusBadRequest)
+	plan, err := planRun(inputArgs, userId, forceRun)
+	if err != nil {
+		writeRunError(w, err)
 		return
 	}
-	methodID := int(algoFloat)
-	method, err := db.GetOptimizationMethodByID(methodID)
+	if plan.Cached {
+		if err := attachCached(experimentID, plan.Matches); err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ids := make([]string, len(plan.Matches))
+		for i, m := range plan.Matches {
+			ids[i] = m.ResultID
+		}
+		recordCacheHit(userId, 0, experimentID, ids)
+		helpers.WriteJSONResponse(w, OptimizationPostResponse{
+			Cached:  true,
+			Matches: plan.Matches,
+		}, http.StatusOK)
+		return
+	}
+
+	plan.Job.Budget = budget
+	check, err := quotaCheck(userId, []*db.Job{plan.Job})
 	if err != nil {
-		helpers.WriteErrorResponse(w, "Ошибка загрузки метода: "+err.Error(), http.StatusInternalServerError)
+		writeRunError(w, err)
 		return
 	}
-	if method == nil {
-		helpers.WriteErrorResponse(w, "Метод не найден", http.StatusBadRequest)
+	plan.Job.ExperimentID = experimentID
+	plan.Job.Priority = db.PriorityInteractive
+	jobID, err := db.InsertJob(plan.Job, check)
+	if err != nil {
+		writeRunError(w, err)
 		return
 	}
+	jobs.Notify()
+
+	helpers.WriteJSONResponse(w, OptimizationPostResponse{
+		Cached:        false,
+		JobID:         jobID,
+		ContainerName: plan.Job.ContainerName,
+		ResultID:      plan.Job.Tag,
+	}, http.StatusAccepted)
+}
+
+// runPlan — подготовленный прогон: либо совпадения из кэша результатов,
+// либо ещё не сохранённое задание для очереди.
+type runPlan struct {
+	Cached  bool
+	Matches []db.OptimizationResult
+	Job     *db.Job
+}
+
+// runError — ошибка подготовки прогона с HTTP-статусом ответа.
+type runError struct {
+	Status  int
+	Message string
+}
+
+func (e *runError) Error() string {
+	return e.Message
+}
+
+func writeRunError(w http.ResponseWriter, err error) {
+	switch e := err.(type) {
+	case *runError:
+		helpers.WriteErrorResponse(w, e.Message, e.Status)
+	case *quotaError:
+		helpers.WriteErrorResponse(w, e.Error(), http.StatusTooManyRequests, map[string]interface{}{
+			"code":      QuotaExceededCode,
+			"limit":     e.Limit,
+			"remaining": e.Remaining,
+		})
+	default:
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// recordCacheHit сохраняет попадание в кэш для потока событий пользователя.
+// Ошибка записи не мешает вернуть найденные результаты.
+func recordCacheHit(userId, batchID, experimentID int, resultIDs []string) {
+	if err := db.RecordCacheHit(userId, batchID, experimentID, resultIDs); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+func popForceRun(inputArgs map[string]interface{}) bool {
+	force, ok := inputArgs["force_run"]
+	if !ok {
+		return false
+	}
+	delete(inputArgs, "force_run")
+	b, ok := force.(bool)
+	return ok && b
+}
+
+// popBudget извлекает expected_budget — ожидаемое число вычислений прогона.
+// Он нужен только квоте и в run.py не передаётся; 0 — не указан.
+func popBudget(inputArgs map[string]interface{}) (int64, error) {
+	raw, ok := inputArgs["expected_budget"]
+	if !ok {
+		return 0, nil
+	}
+	delete(inputArgs, "expected_budget")
+	v, ok := raw.(float64)
+	if !ok || v < 1 || v > 1<<53 || v != math.Trunc(v) {
+		return 0, &runError{http.StatusBadRequest, "expected_budget должен быть положительным целым числом"}
+	}
+	return int64(v), nil
+}
+
+// planRun проверяет параметры одного прогона, ищет готовый результат и
+// собирает аргументы run.py. Общая часть одиночного и пакетного запуска.
+func planRun(inputArgs map[string]interface{}, userId int, forceRun bool) (*runPlan, error) {
+	method, err := resolveMethod(inputArgs)
+	if err != nil {
+		return nil, err
+	}
+	if errs := checkMethodParams(method, inputArgs); len(errs) > 0 {
+		return nil, &runError{http.StatusBadRequest, strings.Join(errs, "; ")}
+	}
 
 	if !forceRun {
 		if err := ValidateCoreFields(inputArgs); err != nil {
-			helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
-			return
+			return nil, &runError{http.StatusBadRequest, err.Error()}
 		}
-	}
 
-	if !forceRun {
 		matches, err := db.SearchOptimizationResults(inputArgs)
 		if err != nil {
-			helpers.WriteErrorResponse(w, "Ошибка поиска: "+err.Error(), http.StatusInternalServerError)
-			return
+			return nil, &runError{http.StatusInternalServerError, "Ошибка поиска: " + err.Error()}
 		}
 		if len(matches) > 0 {
-			helpers.WriteJSONResponse(w, OptimizationPostResponse{
-				Cached:  true,
-				Matches: matches,
-			}, http.StatusOK)
-			return
+			return &runPlan{Cached: true, Matches: matches}, nil
 		}
 	}
 
+	tag := runner.NewTag()
+	return &runPlan{Job: &db.Job{
+		UserID:        userId,
+		MethodID:      method.ID,
+		Parameters:    inputArgs,
+		Args:          runArgs(inputArgs, method, userId),
+		Tag:           tag,
+		ContainerName: runner.Default.Name(tag),
+	}}, nil
+}
+
+// resolveMethod загружает метод, указанный в параметре algorithm.
+func resolveMethod(inputArgs map[string]interface{}) (*db.OptimizationMethod, error) {
+	rawAlgo, ok := inputArgs["algorithm"]
+	if !ok {
+		return nil, &runError{http.StatusBadRequest, "Не указан параметр algorithm"}
+	}
+	algoFloat, ok := rawAlgo.(float64)
+	if !ok {
+		return nil, &runError{http.StatusBadRequest, "Некорректный тип для algorithm"}
+	}
+	method, err := db.GetOptimizationMethodByID(int(algoFloat))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &runError{http.StatusBadRequest, "Метод не найден"}
+	}
+	if err != nil {
+		return nil, &runError{http.StatusInternalServerError, "Ошибка загрузки метода: " + err.Error()}
+	}
+	if method.Name == "" {
+		return nil, &runError{http.StatusBadRequest, "Метод не задан"}
+	}
+	return method, nil
+}
+
+// runArgs собирает аргументы run.py: параметры в виде --key value по
+// алфавиту, затем --method и --user_id.
+func runArgs(inputArgs map[string]interface{}, method *db.OptimizationMethod, userId int) []string {
 	var keys []string
 	for k := range inputArgs {
 		keys = append(keys, k)
@@ -113,33 +254,12 @@ func OptimizationPostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		args = append(args, "--"+k, fmt.Sprint(val))
 	}
+	args = append(args, "--method", method.Name)
 
-	if method.Name != "" {
-		args = append(args, "--method", method.Name)
-	} else {
-		helpers.WriteErrorResponse(w, "Метод не задан", http.StatusBadRequest)
-		return
-	}
-
-	userId, _ := sessions.GetUserIDByToken(r.Header.Get("Authorization"))
 	if userId != 0 {
 		args = append(args, "--user_id", fmt.Sprint(userId))
 	}
-
-	output, err := utils.RunCommand(args)
-	if err != nil {
-		log.Printf("Ошибка запуска команды: %v\nВывод: %s\n", err, string(output))
-		helpers.WriteErrorResponse(w, "Ошибка выполнения команды оптимизации", http.StatusInternalServerError)
-		return
-	}
-
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	container := lines[len(lines)-1]
-
-	helpers.WriteJSONResponse(w, OptimizationPostResponse{
-		Cached:        false,
-		ContainerName: container,
-	}, http.StatusOK)
+	return args
 }
 
 // GET /api/v1/optimization/results/{id}
@@ -151,28 +271,18 @@ func OptimizationResultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resultDir := filepath.Join("results", resultID+".processed")
-	info, err := os.Stat(resultDir)
-	if err != nil || !info.IsDir() {
-		helpers.WriteErrorResponse(w, "Папка с результатом не найдена", http.StatusNotFound)
+	// Ограничения и лучшая точка берутся из БД: при загрузке они пересчитаны
+	// с учётом FeasibilityTolerance, а results.json хранит выбор run.py.
+	res, err := db.LoadOptimizationResult(resultID)
+	if errors.Is(err, db.ErrResultNotFound) {
+		helpers.WriteErrorResponse(w, "Результат не найден", http.StatusNotFound)
 		return
 	}
-
-	jsonPath := filepath.Join(resultDir, "results.json")
-	data, err := os.ReadFile(jsonPath)
 	if err != nil {
-		helpers.WriteErrorResponse(w, "Файл results.json не найден", http.StatusNotFound)
-		return
-	}
-
-	var res db.OptimizationResult
-	if err := json.Unmarshal(data, &res); err != nil {
-		helpers.WriteErrorResponse(w, "Ошибка парсинга results.json", http.StatusInternalServerError)
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	res.ResultID = resultID
-
 	helpers.WriteJSONResponse(w, res, http.StatusOK)
 }
 
@@ -202,36 +312,25 @@ func ContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Не указан контейнер для логирования", http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	cmd := exec.Command("docker", "logs", "-f", containerName)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Не удалось получить логи: %v", err), http.StatusInternalServerError)
-		return
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Не удалось получить stderr: %v", err), http.StatusInternalServerError)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Поток не поддерживает флешинг", http.StatusInternalServerError)
 		return
 	}
-	if err := cmd.Start(); err != nil {
-		http.Error(w, fmt.Sprintf("Не удалось запустить поток логов: %v", err), http.StatusInternalServerError)
+	if err := waitJobStarted(r.Context(), containerName); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Поток не поддерживает флешинг", http.StatusInternalServerError)
+	logs, err := runner.Default.Logs(r.Context(), containerName, true)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Не удалось получить логи: %v", err), http.StatusInternalServerError)
 		return
 	}
-	go func() {
-		errOutput, _ := io.ReadAll(stderr)
-		if len(errOutput) > 0 {
-			log.Printf("stderr: %s", string(errOutput))
-		}
-	}()
-	scanner := bufio.NewScanner(stdout)
+	defer logs.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	scanner := bufio.NewScanner(logs)
 	for scanner.Scan() {
 		line := scanner.Text()
 		fmt.Fprintf(w, "data: %s\n\n", line)
@@ -242,7 +341,25 @@ func ContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Fprintf(w, "event: finish\ndata: Контейнер завершил работу\n\n")
 	flusher.Flush()
-	cmd.Wait()
+}
+
+// waitJobStarted ждёт, пока задание с контейнером name покинет очередь:
+// до этого момента контейнера ещё не существует.
+func waitJobStarted(ctx context.Context, name string) error {
+	for {
+		job, err := db.GetJobByContainerName(name)
+		if err != nil {
+			return err
+		}
+		if job == nil || job.Status != db.JobQueued {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
 }
 
 // GET /api/v1/optimization/results
@@ -261,7 +378,16 @@ func OptimizationResultsHandler(w http.ResponseWriter, r *http.Request) {
 	if offset == "" {
 		offset = "0"
 	}
-	results, err := db.GetOptimizationResults(limit, offset, userId)
+	experimentID := 0
+	if raw := vars.Get("experiment_id"); raw != "" {
+		e, err := scopeExperiment(r, raw)
+		if err != nil {
+			writeRunError(w, err)
+			return
+		}
+		experimentID = e.ID
+	}
+	results, err := db.GetOptimizationResults(limit, offset, userId, experimentID)
 	if err != nil {
 		helpers.WriteErrorResponse(w, "Ошибка получения результатов: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -274,6 +400,57 @@ func SearchOptimizationResultsHandler(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	params := make(map[string]interface{})
 
+	if raw := qs.Get("experiment_id"); raw != "" {
+		e, err := scopeExperiment(r, raw)
+		if err != nil {
+			writeRunError(w, err)
+			return
+		}
+		params["experiment_id"] = db.ExperimentScope(e.ID)
+		qs.Del("experiment_id")
+	}
+
+	// Опорная точка гиперобъёма — не параметр запуска, по ней результаты упорядочиваются.
+	var reference []float64
+	var minHV float64
+	if raw := qs.Get("reference"); raw != "" {
+		var err error
+		if reference, err = parseReference(raw); err == nil {
+			err = checkHypervolumeLimits(reference, 0)
+		}
+		if err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if raw := qs.Get("min_hypervolume"); raw != "" {
+			if minHV, err = strconv.ParseFloat(raw, 64); err != nil {
+				helpers.WriteErrorResponse(w, "Некорректный min_hypervolume", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	qs.Del("reference")
+	qs.Del("min_hypervolume")
+
+	if raw := qs.Get("feasible"); raw != "" {
+		feasible, err := strconv.ParseBool(raw)
+		if err != nil {
+			helpers.WriteErrorResponse(w, "Некорректный feasible", http.StatusBadRequest)
+			return
+		}
+		params["feasible"] = db.FeasibleScope(feasible)
+		qs.Del("feasible")
+	}
+	if raw := qs.Get("max_violation"); raw != "" {
+		maxViolation, err := strconv.ParseFloat(raw, 64)
+		if err != nil || maxViolation < 0 {
+			helpers.WriteErrorResponse(w, "Некорректный max_violation", http.StatusBadRequest)
+			return
+		}
+		params["max_violation"] = db.ViolationRange{Min: 0, Max: maxViolation}
+		qs.Del("max_violation")
+	}
+
 	for k, vs := range qs {
 		if len(vs) == 0 {
 			continue
@@ -324,5 +501,11 @@ func SearchOptimizationResultsHandler(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteErrorResponse(w, "Ошибка поиска: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if reference != nil {
+		if results, err = applyHypervolume(results, reference, minHV); err != nil {
+			writeRunError(w, err)
+			return
+		}
+	}
 	helpers.WriteJSONResponse(w, results, http.StatusOK)
 }
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/gorilla/mux"
+)
+
+// maxHypervolumeObjectives ограничивает число целей при расчёте гиперобъёма.
+const maxHypervolumeObjectives = 4
+
+// maxHypervolumePoints — наибольшее суммарное число точек фронтов, по которым
+// один запрос считает гиперобъём, по числу целей: в худшем случае время счёта
+// растёт как n^(d-1).
+var maxHypervolumePoints = [maxHypervolumeObjectives + 1]int{1: 100000, 2: 100000, 3: 3000, 4: 300}
+
+type HypervolumeRequest struct {
+	ResultIDs []string  `json:"result_ids"`
+	Reference []float64 `json:"reference"`
+}
+
+type HypervolumeValue struct {
+	ResultID    string  `json:"result_id"`
+	Hypervolume float64 `json:"hypervolume"`
+	FrontSize   int     `json:"front_size"`
+}
+
+type HypervolumeSummary struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Std    float64 `json:"std"`
+}
+
+// HypervolumeResponse содержит значения в порядке запроса. В Missing попадают
+// результаты без загруженной истории, Summary пуст, если значений нет.
+type HypervolumeResponse struct {
+	Reference []float64           `json:"reference"`
+	Results   []HypervolumeValue  `json:"results"`
+	Missing   []string            `json:"missing"`
+	Summary   *HypervolumeSummary `json:"summary"`
+}
+
+// GET /api/v1/optimization/results/{id}/pareto?reference={r1,r2,...}
+//
+// Возвращает фронт Парето результата; с reference — ещё и гиперобъём.
+func ResultParetoHandler(w http.ResponseWriter, r *http.Request) {
+	var reference []float64
+	if raw := r.URL.Query().Get("reference"); raw != "" {
+		var err error
+		if reference, err = parseReference(raw); err == nil {
+			err = checkHypervolumeLimits(reference, 0)
+		}
+		if err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	front, err := db.GetParetoFront(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if front == nil {
+		helpers.WriteErrorResponse(w, "История результата не найдена", http.StatusNotFound)
+		return
+	}
+	if reference != nil {
+		err := checkReference(front, reference)
+		if err == nil {
+			err = checkHypervolumeLimits(reference, len(front.Points))
+		}
+		if err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hv := db.Hypervolume(front.Objectives(), reference)
+		front.Hypervolume = &hv
+	}
+	helpers.WriteJSONResponse(w, front, http.StatusOK)
+}
+
+// POST /api/v1/optimization/hypervolume
+//
+// Считает гиперобъём фронтов result_ids относительно reference и сводку по ним.
+func HypervolumeHandler(w http.ResponseWriter, r *http.Request) {
+	var req HypervolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.ResultIDs) == 0 {
+		helpers.WriteErrorResponse(w, "Нужен хотя бы один result_id", http.StatusBadRequest)
+		return
+	}
+	if len(req.ResultIDs) > maxConvergenceResults {
+		helpers.WriteErrorResponse(w, "Слишком много результатов в одном запросе", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reference) == 0 {
+		helpers.WriteErrorResponse(w, "Не указана опорная точка reference", http.StatusBadRequest)
+		return
+	}
+	if err := checkHypervolumeLimits(req.Reference, 0); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeHypervolume(w, req.ResultIDs, req.Reference)
+}
+
+// GET /api/v1/experiments/{id}/hypervolume?reference={r1,r2,...}
+func ExperimentHypervolumeHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadExperiment(w, r)
+	if !ok {
+		return
+	}
+	reference, err := parseReference(r.URL.Query().Get("reference"))
+	if err == nil {
+		err = checkHypervolumeLimits(reference, 0)
+	}
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids, err := db.GetExperimentResultIDs(e.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeHypervolume(w, ids, reference)
+}
+
+func writeHypervolume(w http.ResponseWriter, resultIDs []string, reference []float64) {
+	fronts, err := db.GetParetoFronts(resultIDs)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := HypervolumeResponse{Reference: reference, Results: []HypervolumeValue{}, Missing: []string{}}
+	seen := make(map[string]bool, len(resultIDs))
+	var found []*db.ParetoFront
+	points := 0
+	for _, id := range resultIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		front, ok := fronts[id]
+		if !ok || len(front.ObjectiveNames) == 0 {
+			resp.Missing = append(resp.Missing, id)
+			continue
+		}
+		if err := checkReference(front, reference); err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		found = append(found, front)
+		points += len(front.Points)
+	}
+	if err := checkHypervolumeLimits(reference, points); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var values []float64
+	for _, front := range found {
+		id := front.ResultID
+		hv := db.Hypervolume(front.Objectives(), reference)
+		resp.Results = append(resp.Results, HypervolumeValue{ResultID: id, Hypervolume: hv, FrontSize: len(front.Points)})
+		values = append(values, hv)
+	}
+	resp.Summary = summarize(values)
+	helpers.WriteJSONResponse(w, resp, http.StatusOK)
+}
+
+// applyHypervolume заполняет Hypervolume найденных результатов и упорядочивает
+// их по убыванию гиперобъёма; результаты без фронта подходящей размерности
+// идут последними, а при minHV > 0 отбрасываются.
+func applyHypervolume(results []db.OptimizationResult, reference []float64, minHV float64) ([]db.OptimizationResult, error) {
+	ids := make([]string, len(results))
+	for i, res := range results {
+		ids[i] = res.ResultID
+	}
+	fronts, err := db.GetParetoFronts(ids)
+	if err != nil {
+		return nil, err
+	}
+	points := 0
+	for _, front := range fronts {
+		if len(front.ObjectiveNames) == len(reference) {
+			points += len(front.Points)
+		}
+	}
+	if err := checkHypervolumeLimits(reference, points); err != nil {
+		return nil, &runError{http.StatusBadRequest, err.Error()}
+	}
+	filtered := results[:0]
+	for _, res := range results {
+		if front, ok := fronts[res.ResultID]; ok && len(front.ObjectiveNames) == len(reference) {
+			hv := db.Hypervolume(front.Objectives(), reference)
+			res.Hypervolume = &hv
+		}
+		if minHV > 0 && (res.Hypervolume == nil || *res.Hypervolume < minHV) {
+			continue
+		}
+		filtered = append(filtered, res)
+	}
+	sort.SliceStable(filtered, func(a, b int) bool {
+		ha, hb := filtered[a].Hypervolume, filtered[b].Hypervolume
+		if ha == nil || hb == nil {
+			return ha != nil
+		}
+		return *ha > *hb
+	})
+	return filtered, nil
+}
+
+// parseReference разбирает опорную точку вида "1,2.5,10".
+func parseReference(raw string) ([]float64, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("не указана опорная точка reference")
+	}
+	parts := strings.Split(raw, ",")
+	ref := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("некорректная координата опорной точки: %q", part)
+		}
+		ref[i] = v
+	}
+	return ref, nil
+}
+
+// checkHypervolumeLimits отклоняет расчёт гиперобъёма, который занял бы
+// сервер надолго: по слишком многим целям или по фронтам, в которых вместе
+// больше points точек, чем допускает maxHypervolumePoints.
+func checkHypervolumeLimits(reference []float64, points int) error {
+	if len(reference) > maxHypervolumeObjectives {
+		return fmt.Errorf("гиперобъём считается не более чем по %d целям", maxHypervolumeObjectives)
+	}
+	if limit := maxHypervolumePoints[len(reference)]; points > limit {
+		return fmt.Errorf("во фронтах %d точек, гиперобъём по %d целям считается не более чем по %d",
+			points, len(reference), limit)
+	}
+	return nil
+}
+
+func checkReference(front *db.ParetoFront, reference []float64) error {
+	if len(front.ObjectiveNames) != len(reference) {
+		return fmt.Errorf("у результата %s %d целей, а в опорной точке %d координат",
+			front.ResultID, len(front.ObjectiveNames), len(reference))
+	}
+	return nil
+}
+
+func summarize(values []float64) *HypervolumeSummary {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	s := &HypervolumeSummary{Count: len(sorted), Min: sorted[0], Max: sorted[len(sorted)-1]}
+	for _, v := range sorted {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(sorted))
+	if n := len(sorted); n%2 == 1 {
+		s.Median = sorted[n/2]
+	} else {
+		s.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	for _, v := range sorted {
+		s.Std += (v - s.Mean) * (v - s.Mean)
+	}
+	s.Std = math.Sqrt(s.Std / float64(len(sorted)))
+	return s
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import "testing"
+
+func TestCheckHypervolumeLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference []float64
+		points    int
+		wantErr   bool
+	}{
+		{"two objectives", []float64{1, 1}, 100000, false},
+		{"two objectives over limit", []float64{1, 1}, 100001, true},
+		{"three objectives", []float64{1, 1, 1}, 3000, false},
+		{"three objectives over limit", []float64{1, 1, 1}, 3001, true},
+		{"four objectives", []float64{1, 1, 1, 1}, 300, false},
+		{"four objectives over limit", []float64{1, 1, 1, 1}, 301, true},
+		{"five objectives", []float64{1, 1, 1, 1, 1}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkHypervolumeLimits(tt.reference, tt.points); (err != nil) != tt.wantErr {
+				t.Errorf("checkHypervolumeLimits error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/sessions"
+)
+
+// coreParams — параметры run.py, которые не описываются схемой метода.
+var coreParams = map[string]bool{
+	"algorithm":   true,
+	"problem":     true,
+	"dimension":   true,
+	"instance_id": true,
+	"seed":        true,
+}
+
+// PlanResponse описывает прогон, который был бы запущен тем же запросом к
+// POST /api/v1/optimization. Parameters — значения по умолчанию метода,
+// дополненные значениями пользователя; в Args попадают только переданные
+// пользователем параметры, остальные run.py берёт из метода.
+type PlanResponse struct {
+	Valid      bool                    `json:"valid"`
+	Errors     []string                `json:"errors,omitempty"`
+	Method     *db.OptimizationMethod  `json:"method,omitempty"`
+	Parameters map[string]interface{}  `json:"parameters,omitempty"`
+	Args       []string                `json:"args,omitempty"`
+	Image      string                  `json:"image,omitempty"`
+	Cached     bool                    `json:"cached"`
+	Matches    []db.OptimizationResult `json:"matches,omitempty"`
+}
+
+// POST /api/v1/optimization/plan
+//
+// Принимает то же тело, что и POST /api/v1/optimization, но ничего не запускает.
+func OptimizationPlanHandler(w http.ResponseWriter, r *http.Request) {
+	var inputArgs map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&inputArgs); err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка парсинга JSON", http.StatusBadRequest)
+		return
+	}
+	forceRun := popForceRun(inputArgs)
+	userId, _ := sessions.GetUserIDByToken(r.Header.Get("Authorization"))
+
+	resp := PlanResponse{}
+	// fail добавляет в ответ ошибки проверки запроса. Внутренние ошибки
+	// пишутся сразу, и тогда fail возвращает true.
+	fail := func(err error) bool {
+		if isRequestError(err) {
+			resp.Errors = append(resp.Errors, err.Error())
+			return false
+		}
+		writeRunError(w, err)
+		return true
+	}
+
+	budget, err := popBudget(inputArgs)
+	if err != nil && fail(err) {
+		return
+	}
+	if _, err := popExperiment(inputArgs, userId); err != nil && fail(err) {
+		return
+	}
+	method, err := resolveMethod(inputArgs)
+	if err != nil && fail(err) {
+		return
+	}
+	if err := ValidateCoreFields(inputArgs); err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+
+	if method != nil {
+		resp.Method = method
+		resp.Errors = append(resp.Errors, checkMethodParams(method, inputArgs)...)
+		resp.Parameters = make(map[string]interface{}, len(method.Parameters)+len(inputArgs))
+		for name, p := range method.Parameters {
+			resp.Parameters[name] = p.Default
+		}
+		for k, v := range inputArgs {
+			resp.Parameters[k] = v
+		}
+		resp.Args = runArgs(inputArgs, method, userId)
+		resp.Image = method.Image
+	}
+
+	if !forceRun && len(resp.Errors) == 0 {
+		matches, err := db.SearchOptimizationResults(inputArgs)
+		if err != nil {
+			helpers.WriteErrorResponse(w, "Ошибка поиска: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Cached = len(matches) > 0
+		resp.Matches = matches
+	}
+	if !resp.Cached && method != nil {
+		job := &db.Job{MethodID: method.ID, Budget: budget}
+		if err := checkQuota(userId, []*db.Job{job}); err != nil && fail(err) {
+			return
+		}
+	}
+	resp.Valid = len(resp.Errors) == 0
+	helpers.WriteJSONResponse(w, resp, http.StatusOK)
+}
+
+func isRequestError(err error) bool {
+	switch e := err.(type) {
+	case *runError:
+		return e.Status < http.StatusInternalServerError
+	case *quotaError:
+		return true
+	}
+	return false
+}
+
+// checkMethodParams сверяет параметры запроса со схемой метода: run.py
+// падает на параметрах, которых нет у метода.
+func checkMethodParams(method *db.OptimizationMethod, inputArgs map[string]interface{}) []string {
+	names := make([]string, 0, len(inputArgs))
+	for name := range inputArgs {
+		if !coreParams[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		param, ok := method.Parameters[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("у метода %s нет параметра %s", method.Name, name))
+			continue
+		}
+		if !paramTypeOK(param, inputArgs[name]) {
+			errs = append(errs, fmt.Sprintf("параметр %s должен иметь тип %s", name, param.Type))
+		}
+	}
+	return errs
+}
+
+func paramTypeOK(param db.OptimizationMethodParam, v interface{}) bool {
+	if v == nil {
+		return param.Nullable
+	}
+	switch param.Type {
+	case "int":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "float":
+		_, ok := v.(float64)
+		return ok
+	case "string":
+		// Форма запуска отправляет числовой текст числом, а в аргументы
+		// run.py значение всё равно попадает строкой.
+		switch v.(type) {
+		case string, float64, bool:
+			return true
+		}
+		return false
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+func TestCheckMethodParams(t *testing.T) {
+	method := &db.OptimizationMethod{
+		Name: "bo",
+		Parameters: map[string]db.OptimizationMethodParam{
+			"n_init":  {Type: "int"},
+			"xi":      {Type: "float"},
+			"kernel":  {Type: "string"},
+			"verbose": {Type: "bool"},
+			"budget":  {Type: "int", Nullable: true},
+		},
+	}
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want []string
+	}{
+		{"core parameters only", map[string]interface{}{"algorithm": 1.0, "problem": "f1", "dimension": 2.0, "instance_id": 1.0, "seed": 0.0}, nil},
+		{"valid values", map[string]interface{}{"n_init": 5.0, "xi": 0.01, "kernel": "rbf", "verbose": true}, nil},
+		{"unknown parameter", map[string]interface{}{"n_iter": 10.0}, []string{"у метода bo нет параметра n_iter"}},
+		{"whole float for int", map[string]interface{}{"n_init": 5.0}, nil},
+		{"fractional float for int", map[string]interface{}{"n_init": 5.5}, []string{"параметр n_init должен иметь тип int"}},
+		{"whole number for float", map[string]interface{}{"xi": 1.0}, nil},
+		{"string for float", map[string]interface{}{"xi": "0.1"}, []string{"параметр xi должен иметь тип float"}},
+		{"number for string", map[string]interface{}{"kernel": 5.0}, nil},
+		{"bool for string", map[string]interface{}{"kernel": false}, nil},
+		{"object for string", map[string]interface{}{"kernel": map[string]interface{}{}}, []string{"параметр kernel должен иметь тип string"}},
+		{"number for bool", map[string]interface{}{"verbose": 1.0}, []string{"параметр verbose должен иметь тип bool"}},
+		{"nil for nullable", map[string]interface{}{"budget": nil}, nil},
+		{"nil for non-nullable", map[string]interface{}{"n_init": nil}, []string{"параметр n_init должен иметь тип int"}},
+		{"errors sorted by name", map[string]interface{}{"zeta": 1.0, "alpha": 1.0}, []string{"у метода bo нет параметра alpha", "у метода bo нет параметра zeta"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkMethodParams(method, tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkMethodParams = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
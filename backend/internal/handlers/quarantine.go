@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
+	"github.com/gorilla/mux"
+)
+
+type QuarantineFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type QuarantineDetail struct {
+	db.IngestFailure
+	Files []QuarantineFile `json:"files"`
+}
+
+// GET /api/v1/quarantine?limit={limit}&offset={offset}
+func ListQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+	limit, err := strconv.Atoi(vars.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(vars.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	list, err := db.GetIngestFailures(limit, offset)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+// GET /api/v1/quarantine/{id}
+//
+// Возвращает ошибку загрузки и список файлов папки <id>.failed.
+func GetQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadIngestFailure(w, r)
+	if !ok {
+		return
+	}
+	detail := QuarantineDetail{IngestFailure: *f, Files: []QuarantineFile{}}
+	entries, err := os.ReadDir(filepath.Join(jobs.Default.ResultsDir, f.ResultID) + db.FailedSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		detail.Files = append(detail.Files, QuarantineFile{Name: e.Name(), Size: info.Size()})
+	}
+	helpers.WriteJSONResponse(w, detail, http.StatusOK)
+}
+
+// POST /api/v1/quarantine/{id}/retry
+//
+// Загружает папку заново, например после исправления results.json или метода.
+// Если загрузка снова не удалась, папка остаётся в карантине.
+func RetryQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadIngestFailure(w, r)
+	if !ok {
+		return
+	}
+	err := db.RetryIngestFailure(jobs.Default.ResultsDir, f.ResultID)
+	if errors.Is(err, db.ErrIngestFailed) {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"message": "Результат загружен", "result_id": f.ResultID}, http.StatusOK)
+}
+
+// DELETE /api/v1/quarantine/{id}
+//
+// Удаляет папку <id>.failed вместе с файлами.
+func DiscardQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadIngestFailure(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DiscardIngestFailure(jobs.Default.ResultsDir, f.ResultID); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"message": "Результат удалён из карантина"}, http.StatusOK)
+}
+
+func loadIngestFailure(w http.ResponseWriter, r *http.Request) (*db.IngestFailure, bool) {
+	f, err := db.GetIngestFailure(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if f == nil {
+		helpers.WriteErrorResponse(w, "Результат не найден в карантине", http.StatusNotFound)
+		return nil, false
+	}
+	return f, true
+}
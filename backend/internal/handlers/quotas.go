@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/gorilla/mux"
+)
+
+// QuotaExceededCode передаётся в meta.code ответа 429 вместе с названием
+// исчерпанного лимита (meta.limit) и остатком квоты (meta.remaining).
+const QuotaExceededCode = "quota_exceeded"
+
+const (
+	LimitConcurrent   = "max_concurrent"
+	LimitRunsPerDay   = "max_runs_per_day"
+	LimitBudgetPerDay = "max_budget_per_day"
+)
+
+type quotaError struct {
+	Limit     string
+	Remaining db.Allowance
+}
+
+func (e *quotaError) Error() string {
+	switch e.Limit {
+	case LimitConcurrent:
+		return "Достигнут лимит одновременных прогонов"
+	case LimitRunsPerDay:
+		return "Превышен дневной лимит прогонов"
+	default:
+		return "Исчерпан дневной бюджет вычислений"
+	}
+}
+
+type UsageResponse struct {
+	Quota     db.Quota     `json:"quota"`
+	Usage     db.Usage     `json:"usage"`
+	Remaining db.Allowance `json:"remaining"`
+}
+
+// quotaCheck возвращает проверку квоты для постановки заданий jobs одним
+// запросом; запрос, в том числе пакет, считается одним прогоном, а бюджет —
+// суммой бюджетов заданий. Если квота ограничивает бюджет, бюджет каждого
+// задания оценивается по estimateBudget. userId 0 — анонимный запуск.
+// Возвращает nil, если квота не задана.
+func quotaCheck(userId int, jobs []*db.Job) (db.QuotaCheck, error) {
+	var user *db.User
+	if userId != 0 {
+		var err error
+		if user, err = db.FindUserById(userId); err != nil {
+			return nil, err
+		}
+	}
+	quota, err := db.QuotaFor(user)
+	if err != nil {
+		return nil, err
+	}
+	if quota == (db.Quota{}) {
+		return nil, nil
+	}
+	var budget int64
+	if quota.MaxBudgetPerDay > 0 {
+		if budget, err = estimateBudget(jobs); err != nil {
+			return nil, err
+		}
+	}
+	return func(usage db.Usage) error {
+		return exceedsQuota(quota, usage, budget)
+	}, nil
+}
+
+// estimateBudget выставляет Budget каждого задания не ниже среднего бюджета
+// прошлых результатов его метода и возвращает суммарный бюджет. Заявленный
+// expected_budget может только увеличить оценку, иначе квоту можно обойти,
+// занизив его.
+func estimateBudget(jobs []*db.Job) (int64, error) {
+	methodIDs := make([]int, len(jobs))
+	for i, job := range jobs {
+		methodIDs[i] = job.MethodID
+	}
+	averages, err := db.MethodBudgets(methodIDs)
+	if err != nil {
+		return 0, err
+	}
+	return chargeBudgets(jobs, averages)
+}
+
+// chargeBudgets поднимает Budget заданий до averages их методов. Задание без
+// заявленного бюджета и без прошлых результатов метода отклоняется.
+func chargeBudgets(jobs []*db.Job, averages map[int]int64) (int64, error) {
+	var total int64
+	for _, job := range jobs {
+		if avg := averages[job.MethodID]; avg > job.Budget {
+			job.Budget = avg
+		}
+		if job.Budget <= 0 {
+			return 0, &runError{http.StatusBadRequest, "Не удалось оценить бюджет прогона: у метода нет результатов, укажите expected_budget"}
+		}
+		total += job.Budget
+	}
+	return total, nil
+}
+
+// checkQuota проверяет квоту без постановки заданий, например для плана запуска.
+func checkQuota(userId int, jobs []*db.Job) error {
+	check, err := quotaCheck(userId, jobs)
+	if err != nil || check == nil {
+		return err
+	}
+	usage, err := db.GetUsage(userId)
+	if err != nil {
+		return err
+	}
+	return check(usage)
+}
+
+// exceedsQuota возвращает quotaError, если ещё один запуск с суммарным
+// бюджетом budget не укладывается в квоту при потреблении usage. Лимит
+// одновременных прогонов отклоняет запуск, когда активных заданий уже не
+// меньше лимита; сам запуск может быть больше лимита, его лишние задания
+// ждут в очереди, пока ClaimJob не освободит слот.
+func exceedsQuota(quota db.Quota, usage db.Usage, budget int64) error {
+	qe := &quotaError{Remaining: quota.Remaining(usage)}
+	switch {
+	case quota.MaxConcurrent > 0 && usage.Active >= quota.MaxConcurrent:
+		qe.Limit = LimitConcurrent
+	case quota.MaxRunsPerDay > 0 && usage.RunsToday >= quota.MaxRunsPerDay:
+		qe.Limit = LimitRunsPerDay
+	case quota.MaxBudgetPerDay > 0 &&
+		(usage.BudgetToday >= quota.MaxBudgetPerDay || usage.BudgetToday+budget > quota.MaxBudgetPerDay):
+		qe.Limit = LimitBudgetPerDay
+	default:
+		return nil
+	}
+	return qe
+}
+
+// GET /api/v1/user/usage
+func UserUsageHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	quota, err := db.QuotaFor(user)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	usage, err := db.GetUsage(user.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, UsageResponse{
+		Quota:     quota,
+		Usage:     usage,
+		Remaining: quota.Remaining(usage),
+	}, http.StatusOK)
+}
+
+// GET /api/v1/quotas
+func ListQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := db.GetAllQuotas()
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+// PUT /api/v1/quotas/users/{id}
+func UpdateUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	quota, ok := decodeQuota(w, r)
+	if !ok {
+		return
+	}
+	if _, err := db.FindUserById(id); err != nil {
+		helpers.WriteErrorResponse(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+	if err := db.SetUserQuota(id, quota); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, db.QuotaEntry{UserID: id, Quota: quota}, http.StatusOK)
+}
+
+// PUT /api/v1/quotas/groups/{group}
+//
+// Группа anonymous ограничивает запуски без авторизации.
+func UpdateGroupQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	group := mux.Vars(r)["group"]
+	quota, ok := decodeQuota(w, r)
+	if !ok {
+		return
+	}
+	if err := db.SetGroupQuota(group, quota); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, db.QuotaEntry{Group: group, Quota: quota}, http.StatusOK)
+}
+
+func decodeQuota(w http.ResponseWriter, r *http.Request) (db.Quota, bool) {
+	var quota db.Quota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return quota, false
+	}
+	if quota.MaxConcurrent < 0 || quota.MaxRunsPerDay < 0 || quota.MaxBudgetPerDay < 0 {
+		helpers.WriteErrorResponse(w, "Квоты не могут быть отрицательными", http.StatusBadRequest)
+		return quota, false
+	}
+	return quota, true
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+func TestExceedsQuota(t *testing.T) {
+	quota := db.Quota{MaxConcurrent: 2, MaxRunsPerDay: 5, MaxBudgetPerDay: 1000}
+	tests := []struct {
+		name   string
+		usage  db.Usage
+		budget int64
+		want   string
+	}{
+		{"within quota", db.Usage{Active: 1, RunsToday: 4, BudgetToday: 500}, 500, ""},
+		{"at concurrent limit", db.Usage{Active: 2}, 0, LimitConcurrent},
+		{"over concurrent limit", db.Usage{Active: 7}, 0, LimitConcurrent},
+		{"large batch with empty queue", db.Usage{}, 900, ""},
+		{"runs per day", db.Usage{RunsToday: 5}, 0, LimitRunsPerDay},
+		{"batch is one run", db.Usage{RunsToday: 4}, 0, ""},
+		{"budget already spent", db.Usage{BudgetToday: 1000}, 0, LimitBudgetPerDay},
+		{"budget of submission", db.Usage{BudgetToday: 600}, 401, LimitBudgetPerDay},
+		{"budget exactly at limit", db.Usage{BudgetToday: 600}, 400, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exceedsQuota(quota, tt.usage, tt.budget)
+			got := ""
+			if qe, ok := err.(*quotaError); ok {
+				got = qe.Limit
+			} else if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("limit = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChargeBudgets(t *testing.T) {
+	averages := map[int]int64{1: 500}
+	tests := []struct {
+		name     string
+		methodID int
+		declared int64
+		want     int64
+		wantErr  bool
+	}{
+		{"average when not declared", 1, 0, 500, false},
+		{"declared below average", 1, 1, 500, false},
+		{"declared above average", 1, 800, 800, false},
+		{"declared without history", 2, 300, 300, false},
+		{"no estimate", 2, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &db.Job{MethodID: tt.methodID, Budget: tt.declared}
+			total, err := chargeBudgets([]*db.Job{job}, averages)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("chargeBudgets error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (total != tt.want || job.Budget != tt.want) {
+				t.Errorf("total = %d, Budget = %d, want %d", total, job.Budget, tt.want)
+			}
+		})
+	}
+
+	jobs := []*db.Job{{MethodID: 1, Budget: 1}, {MethodID: 1, Budget: 1}, {MethodID: 1, Budget: 1}}
+	if total, err := chargeBudgets(jobs, averages); err != nil || total != 1500 {
+		t.Errorf("batch of understated runs charged %d, %v; want 1500", total, err)
+	}
+}
+
+func TestPopBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		want    int64
+		wantErr bool
+	}{
+		{"absent", map[string]interface{}{}, 0, false},
+		{"whole number", map[string]interface{}{"expected_budget": 200.0}, 200, false},
+		{"zero", map[string]interface{}{"expected_budget": 0.0}, 0, true},
+		{"negative", map[string]interface{}{"expected_budget": -5.0}, 0, true},
+		{"fractional", map[string]interface{}{"expected_budget": 1.5}, 0, true},
+		{"too large", map[string]interface{}{"expected_budget": 1e300}, 0, true},
+		{"string", map[string]interface{}{"expected_budget": "100"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := popBudget(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("popBudget error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("popBudget = %d, want %d", got, tt.want)
+			}
+			if _, ok := tt.args["expected_budget"]; ok {
+				t.Error("expected_budget left in parameters")
+			}
+		})
+	}
+}
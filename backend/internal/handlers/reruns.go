@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
+	"github.com/gorilla/mux"
+)
+
+// DefaultRerunTolerance — относительный допуск сравнения повторного прогона
+// с исходным, если в запросе не передан tolerance.
+const DefaultRerunTolerance = 1e-9
+
+type RerunResponse struct {
+	JobID         int    `json:"job_id"`
+	ContainerName string `json:"container_name"`
+	ResultID      string `json:"result_id"`
+	RerunOf       string `json:"rerun_of"`
+}
+
+// POST /api/v1/optimization/results/{id}/rerun
+//
+// Ставит в очередь прогон с параметрами результата {id}, минуя кэш.
+func RerunResultHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	resultID := mux.Vars(r)["id"]
+	original, err := db.LoadOptimizationResult(resultID)
+	if errors.Is(err, db.ErrResultNotFound) {
+		helpers.WriteErrorResponse(w, "Результат не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inputArgs := make(map[string]interface{}, len(original.Parameters))
+	for k, v := range original.Parameters {
+		inputArgs[k] = v
+	}
+	// run.py сохраняет вместе с параметрами --method и --user_id,
+	// planRun добавляет их заново.
+	delete(inputArgs, "method")
+	delete(inputArgs, "user_id")
+
+	method, err := resolveMethod(inputArgs)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	coerceParams(method, inputArgs)
+
+	plan, err := planRun(inputArgs, user.ID, true)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	// Бюджет повтора известен по исходному результату.
+	plan.Job.Budget = int64(original.ExpectedBudget)
+	check, err := quotaCheck(user.ID, []*db.Job{plan.Job})
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	plan.Job.RerunOf = resultID
+	plan.Job.Priority = db.PriorityInteractive
+	jobID, err := db.InsertJob(plan.Job, check)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	jobs.Notify()
+
+	helpers.WriteJSONResponse(w, RerunResponse{
+		JobID:         jobID,
+		ContainerName: plan.Job.ContainerName,
+		ResultID:      plan.Job.Tag,
+		RerunOf:       resultID,
+	}, http.StatusAccepted)
+}
+
+// coerceParams приводит сохранённые параметры к типам из схемы метода.
+// run.py разбирает аргументы по виду строки: число без точки, например
+// 1e-05, остаётся строкой, а строковый параметр "5" становится числом.
+// Значения, которые не удаётся привести, остаются как есть, их отклонит
+// checkMethodParams.
+func coerceParams(method *db.OptimizationMethod, params map[string]interface{}) {
+	for name, v := range params {
+		param, ok := method.Parameters[name]
+		if !ok || v == nil {
+			continue
+		}
+		switch param.Type {
+		case "int", "float":
+			if s, ok := v.(string); ok {
+				if f, err := strconv.ParseFloat(s, 64); err == nil {
+					params[name] = f
+				}
+			}
+		case "bool":
+			if s, ok := v.(string); ok {
+				if b, err := strconv.ParseBool(s); err == nil {
+					params[name] = b
+				}
+			}
+		case "string":
+			switch x := v.(type) {
+			case float64:
+				params[name] = strconv.FormatFloat(x, 'f', -1, 64)
+			case bool:
+				params[name] = strconv.FormatBool(x)
+			}
+		}
+	}
+}
+
+// GET /api/v1/optimization/results/{id}/reruns?tolerance={tolerance}
+func ResultRerunsHandler(w http.ResponseWriter, r *http.Request) {
+	tol, ok := rerunTolerance(w, r)
+	if !ok {
+		return
+	}
+	list, err := db.GetReruns(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		if err := compareRerun(&list[i], tol); err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+func rerunTolerance(w http.ResponseWriter, r *http.Request) (float64, bool) {
+	raw := r.URL.Query().Get("tolerance")
+	if raw == "" {
+		return DefaultRerunTolerance, true
+	}
+	tol, err := strconv.ParseFloat(raw, 64)
+	if err != nil || tol < 0 {
+		helpers.WriteErrorResponse(w, "Некорректный tolerance", http.StatusBadRequest)
+		return 0, false
+	}
+	return tol, true
+}
+
+// compareRerun заполняет job.Rerun, если задание повторяет другой результат
+// и его собственный результат уже загружен.
+func compareRerun(job *db.Job, tol float64) error {
+	if job.RerunOf == "" || job.ResultID == "" {
+		return nil
+	}
+	original, err := db.LoadOptimizationResult(job.RerunOf)
+	if err != nil {
+		return err
+	}
+	rerun, err := db.LoadOptimizationResult(job.ResultID)
+	if err != nil {
+		return err
+	}
+	c := db.CompareResults(original, rerun, tol)
+	job.Rerun = &c
+	return nil
+}
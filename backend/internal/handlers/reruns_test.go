@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+func TestCoerceParams(t *testing.T) {
+	method := &db.OptimizationMethod{
+		Name: "bo",
+		Parameters: map[string]db.OptimizationMethodParam{
+			"n_init":  {Type: "int"},
+			"xi":      {Type: "float"},
+			"kernel":  {Type: "string"},
+			"verbose": {Type: "bool"},
+			"budget":  {Type: "int", Nullable: true},
+		},
+	}
+	tests := []struct {
+		name   string
+		stored map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{"small float stored as string", map[string]interface{}{"xi": "1e-05"}, map[string]interface{}{"xi": 1e-05}},
+		{"int stored as string", map[string]interface{}{"n_init": "1e+01"}, map[string]interface{}{"n_init": 10.0}},
+		{"numeric string parameter", map[string]interface{}{"kernel": 5.0}, map[string]interface{}{"kernel": "5"}},
+		{"bool string parameter", map[string]interface{}{"kernel": true}, map[string]interface{}{"kernel": "true"}},
+		{"bool stored as string", map[string]interface{}{"verbose": "false"}, map[string]interface{}{"verbose": false}},
+		{"values of the right type", map[string]interface{}{"xi": 0.1, "kernel": "rbf", "budget": nil}, map[string]interface{}{"xi": 0.1, "kernel": "rbf", "budget": nil}},
+		{"core parameters untouched", map[string]interface{}{"algorithm": 1.0, "problem": "f1", "dimension": 2.0}, map[string]interface{}{"algorithm": 1.0, "problem": "f1", "dimension": 2.0}},
+		{"unparsable value kept", map[string]interface{}{"xi": "abc"}, map[string]interface{}{"xi": "abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coerceParams(method, tt.stored)
+			if !reflect.DeepEqual(tt.stored, tt.want) {
+				t.Errorf("coerceParams = %v, want %v", tt.stored, tt.want)
+			}
+		})
+	}
+}
+
+// TestRerunParamsPassCheck проверяет, что параметры, сохранённые run.py для
+// исходного прогона, проходят проверку схемы при повторном запуске.
+func TestRerunParamsPassCheck(t *testing.T) {
+	method := &db.OptimizationMethod{
+		Name: "bo",
+		Parameters: map[string]db.OptimizationMethodParam{
+			"xi":     {Type: "float"},
+			"kernel": {Type: "string"},
+		},
+	}
+	stored := map[string]interface{}{
+		"algorithm": 1.0, "problem": "f1", "dimension": 2.0, "instance_id": 1.0, "seed": 0.0,
+		"xi": "1e-05", "kernel": 52.0,
+	}
+	coerceParams(method, stored)
+	if errs := checkMethodParams(method, stored); errs != nil {
+		t.Errorf("checkMethodParams after coerceParams = %q, want none", errs)
+	}
+}
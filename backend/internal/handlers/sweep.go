@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/sampling"
+)
+
+// SweepRequest описывает подбор гиперпараметров метода: Parameters задают
+// общие для всех прогонов значения, Bounds — область выборки параметров метода.
+type SweepRequest struct {
+	Parameters   map[string]interface{} `json:"parameters"`
+	Bounds       map[string]SweepBound  `json:"bounds"`
+	Sampler      string                 `json:"sampler"`
+	Samples      int                    `json:"samples"`
+	Seed         *int64                 `json:"sampler_seed,omitempty"`
+	ForceRun     bool                   `json:"force_run,omitempty"`
+	ExperimentID int                    `json:"experiment_id,omitempty"`
+	// ExpectedBudget — ожидаемый бюджет каждого прогона для квоты.
+	ExpectedBudget int64 `json:"expected_budget,omitempty"`
+}
+
+// SweepBound — область значений одного параметра: отрезок [min, max] для
+// чисел (Log — равномерно по логарифму) или список Choices.
+type SweepBound struct {
+	Min     *float64      `json:"min,omitempty"`
+	Max     *float64      `json:"max,omitempty"`
+	Log     bool          `json:"log,omitempty"`
+	Choices []interface{} `json:"choices,omitempty"`
+}
+
+// POST /api/v1/optimization/sweep
+func OptimizationSweepHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	var req SweepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка парсинга JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Samples <= 0 || req.Samples > MaxBatchRuns {
+		helpers.WriteErrorResponse(w, fmt.Sprintf("samples должно быть от 1 до %d", MaxBatchRuns), http.StatusBadRequest)
+		return
+	}
+	if len(req.Bounds) == 0 {
+		helpers.WriteErrorResponse(w, "Не заданы границы параметров", http.StatusBadRequest)
+		return
+	}
+	if req.Parameters == nil {
+		req.Parameters = map[string]interface{}{}
+	}
+	if popForceRun(req.Parameters) {
+		req.ForceRun = true
+	}
+	if budget, err := popBudget(req.Parameters); err != nil {
+		writeRunError(w, err)
+		return
+	} else if budget > 0 {
+		req.ExpectedBudget = budget
+	}
+	if req.ExpectedBudget < 0 {
+		helpers.WriteErrorResponse(w, "expected_budget должен быть положительным целым числом", http.StatusBadRequest)
+		return
+	}
+	if id, ok := req.Parameters["experiment_id"].(float64); ok {
+		delete(req.Parameters, "experiment_id")
+		req.ExperimentID = int(id)
+	}
+	if req.ExperimentID != 0 {
+		if _, err := experimentForRun(user.ID, req.ExperimentID); err != nil {
+			writeRunError(w, err)
+			return
+		}
+	}
+	for k, v := range req.Parameters {
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			helpers.WriteErrorResponse(w, fmt.Sprintf("параметр %s должен быть одним значением", k), http.StatusBadRequest)
+			return
+		}
+	}
+
+	method, err := resolveMethod(req.Parameters)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	names := make([]string, 0, len(req.Bounds))
+	for name := range req.Bounds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, fixed := req.Parameters[name]; fixed {
+			helpers.WriteErrorResponse(w, fmt.Sprintf("параметр %s задан и значением, и границами", name), http.StatusBadRequest)
+			return
+		}
+		if err := checkBound(method, name, req.Bounds[name]); err != nil {
+			helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Sampler == "" {
+		req.Sampler = sampling.Random
+	}
+	if req.Seed == nil {
+		// Сид хранится в JSON спецификации, поэтому должен точно помещаться в float64.
+		seed := time.Now().UnixNano() % 1e9
+		req.Seed = &seed
+	}
+	points, err := sampling.Sample(req.Sampler, req.Samples, len(names), *req.Seed)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	combos := make([]map[string]interface{}, len(points))
+	for i, point := range points {
+		params := make(map[string]interface{}, len(req.Parameters)+len(names))
+		for k, v := range req.Parameters {
+			params[k] = v
+		}
+		for j, name := range names {
+			params[name] = scaleSample(method.Parameters[name].Type, req.Bounds[name], point[j])
+		}
+		combos[i] = params
+	}
+
+	spec, err := sweepSpec(req)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	batch := &db.Batch{UserID: user.ID, ExperimentID: req.ExperimentID, Kind: db.BatchSweep, Spec: spec}
+	resp, err := submitBatch(batch, combos, req.ForceRun, req.ExpectedBudget)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, resp, http.StatusAccepted)
+}
+
+// checkBound сверяет границы параметра со схемой метода.
+func checkBound(method *db.OptimizationMethod, name string, b SweepBound) error {
+	param, ok := method.Parameters[name]
+	if !ok {
+		return fmt.Errorf("у метода %s нет параметра %s", method.Name, name)
+	}
+	if len(b.Choices) > 0 {
+		return nil
+	}
+	if param.Type != "int" && param.Type != "float" {
+		return fmt.Errorf("для параметра %s типа %s нужен список choices", name, param.Type)
+	}
+	if b.Min == nil || b.Max == nil {
+		return fmt.Errorf("для параметра %s нужны min и max", name)
+	}
+	if *b.Min > *b.Max {
+		return fmt.Errorf("для параметра %s min больше max", name)
+	}
+	if param.Type == "int" && math.Ceil(*b.Min) > math.Floor(*b.Max) {
+		return fmt.Errorf("в границах параметра %s нет целых значений", name)
+	}
+	if b.Log && *b.Min <= 0 {
+		return fmt.Errorf("логарифмическая шкала параметра %s требует min > 0", name)
+	}
+	return nil
+}
+
+// scaleSample переводит координату u из [0, 1) в значение параметра.
+func scaleSample(paramType string, b SweepBound, u float64) interface{} {
+	if len(b.Choices) > 0 {
+		i := int(u * float64(len(b.Choices)))
+		if i >= len(b.Choices) {
+			i = len(b.Choices) - 1
+		}
+		return b.Choices[i]
+	}
+	lo, hi := *b.Min, *b.Max
+	if paramType == "int" {
+		// Каждое целое из [min, max] получает равную долю отрезка.
+		lo, hi = math.Ceil(lo), math.Floor(hi)
+		if b.Log {
+			v := math.Floor(math.Exp(math.Log(lo) + u*(math.Log(hi+1)-math.Log(lo))))
+			return math.Min(v, hi)
+		}
+		return math.Min(lo+math.Floor(u*(hi-lo+1)), hi)
+	}
+	if b.Log {
+		return math.Exp(math.Log(lo) + u*(math.Log(hi)-math.Log(lo)))
+	}
+	return lo + u*(hi-lo)
+}
+
+func sweepSpec(req SweepRequest) (map[string]interface{}, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	return spec, json.Unmarshal(raw, &spec)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import "testing"
+
+func TestScaleSample(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name      string
+		paramType string
+		bound     SweepBound
+		u         float64
+		want      interface{}
+	}{
+		{"float start", "float", SweepBound{Min: f(-1), Max: f(3)}, 0, -1.0},
+		{"float middle", "float", SweepBound{Min: f(-1), Max: f(3)}, 0.25, 0.0},
+		{"float log", "float", SweepBound{Min: f(1), Max: f(100), Log: true}, 0.5, 10.0},
+		{"int start", "int", SweepBound{Min: f(1), Max: f(4)}, 0, 1.0},
+		{"int equal shares", "int", SweepBound{Min: f(1), Max: f(4)}, 0.49, 2.0},
+		{"int last share", "int", SweepBound{Min: f(1), Max: f(4)}, 0.75, 4.0},
+		{"int near one", "int", SweepBound{Min: f(1), Max: f(4)}, 0.999999, 4.0},
+		{"int fractional bounds", "int", SweepBound{Min: f(0.5), Max: f(2.5)}, 0.5, 2.0},
+		{"int single value", "int", SweepBound{Min: f(3), Max: f(3)}, 0.9, 3.0},
+		{"int log start", "int", SweepBound{Min: f(1), Max: f(99), Log: true}, 0, 1.0},
+		{"int log middle", "int", SweepBound{Min: f(1), Max: f(99), Log: true}, 0.5, 10.0},
+		{"int log near one", "int", SweepBound{Min: f(1), Max: f(99), Log: true}, 0.999999, 99.0},
+		{"choices first", "string", SweepBound{Choices: []interface{}{"a", "b", "c"}}, 0.3, "a"},
+		{"choices last", "string", SweepBound{Choices: []interface{}{"a", "b", "c"}}, 0.999999, "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scaleSample(tt.paramType, tt.bound, tt.u)
+			if g, ok := got.(float64); ok {
+				if w := tt.want.(float64); g < w-1e-9 || g > w+1e-9 {
+					t.Errorf("scaleSample = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("scaleSample = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/gorilla/mux"
+)
+
+type WebhookRequest struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// POST /api/v1/webhooks
+//
+// Секрет подписи возвращается только в ответе на создание.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if req.URL == nil || len(req.Events) == 0 {
+		helpers.WriteErrorResponse(w, "Нужны url и events", http.StatusBadRequest)
+		return
+	}
+	h := &db.Webhook{UserID: user.ID, Active: true}
+	if err := applyWebhookRequest(h, req); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.Secret = hex.EncodeToString(secret)
+	id, err := db.InsertWebhook(h)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created, err := db.GetWebhook(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created.Secret = h.Secret
+	helpers.WriteJSONResponse(w, created, http.StatusCreated)
+}
+
+// GET /api/v1/webhooks
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	hooks, err := db.GetWebhooksByUser(user.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, hooks, http.StatusOK)
+}
+
+// PUT /api/v1/webhooks/{id}
+//
+// Меняет только переданные поля: url, events и active.
+func UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Events != nil && len(req.Events) == 0 {
+		helpers.WriteErrorResponse(w, "Список events не может быть пустым", http.StatusBadRequest)
+		return
+	}
+	if err := applyWebhookRequest(h, req); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateWebhook(h); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, h, http.StatusOK)
+}
+
+// DELETE /api/v1/webhooks/{id}
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteWebhook(h.ID); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"message": "Вебхук удалён"}, http.StatusOK)
+}
+
+// GET /api/v1/webhooks/{id}/deliveries?limit={limit}&offset={offset}
+func WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	vars := r.URL.Query()
+	limit, err := strconv.Atoi(vars.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(vars.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	list, err := db.GetWebhookDeliveries(h.ID, limit, offset)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, list, http.StatusOK)
+}
+
+func applyWebhookRequest(h *db.Webhook, req WebhookRequest) error {
+	if req.URL != nil {
+		u, err := url.Parse(*req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url должен быть адресом http или https")
+		}
+		h.URL = u.String()
+	}
+	if req.Events != nil {
+		known := make(map[string]bool, len(db.WebhookEvents))
+		for _, e := range db.WebhookEvents {
+			known[e] = true
+		}
+		seen := make(map[string]bool, len(req.Events))
+		events := make([]string, 0, len(req.Events))
+		for _, e := range req.Events {
+			if !known[e] {
+				return fmt.Errorf("неизвестное событие %s, допустимы: %v", e, db.WebhookEvents)
+			}
+			if !seen[e] {
+				seen[e] = true
+				events = append(events, e)
+			}
+		}
+		h.Events = events
+	}
+	if req.Active != nil {
+		h.Active = *req.Active
+	}
+	return nil
+}
+
+// loadWebhook загружает вебхук из пути запроса; доступ есть у владельца и администраторов.
+func loadWebhook(w http.ResponseWriter, r *http.Request) (*db.Webhook, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID вебхука", http.StatusBadRequest)
+		return nil, false
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return nil, false
+	}
+	h, err := db.GetWebhook(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if h == nil {
+		helpers.WriteErrorResponse(w, "Вебхук не найден", http.StatusNotFound)
+		return nil, false
+	}
+	if h.UserID != user.ID && user.Group != "admin" {
+		helpers.WriteErrorResponse(w, "Недостаточно прав для доступа к вебхуку", http.StatusForbidden)
+		return nil, false
+	}
+	return h, true
+}
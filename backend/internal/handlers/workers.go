@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/jobs"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+	"github.com/axywe/distributed-benchmarks/internal/workerapi"
+	"github.com/gorilla/mux"
+)
+
+const maxResultsUpload = 256 << 20
+
+// POST /api/v1/workers/register
+func RegisterWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	var req workerapi.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		helpers.WriteErrorResponse(w, "Не указано имя воркера", http.StatusBadRequest)
+		return
+	}
+	if req.Capacity <= 0 {
+		req.Capacity = 1
+	}
+	id, err := db.RegisterWorker(req.Name, req.Capacity, req.Runner)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobs.Notify()
+	log.Printf("Воркер %q зарегистрирован (id %d, слотов %d)", req.Name, id, req.Capacity)
+	helpers.WriteJSONResponse(w, workerapi.RegisterResponse{
+		WorkerID:                 id,
+		HeartbeatIntervalSeconds: int((jobs.WorkerTimeout / 3).Seconds()),
+	}, http.StatusOK)
+}
+
+// POST /api/v1/workers/{id}/heartbeat
+func WorkerHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	worker, ok := loadWorker(w, r)
+	if !ok {
+		return
+	}
+	var req workerapi.HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if err := db.TouchWorker(worker.ID); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stop, err := db.JobsToStop(worker.ID, req.Running)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := releaseMissingJobs(worker.ID, req.Running); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, workerapi.HeartbeatResponse{Cancel: stop}, http.StatusOK)
+}
+
+// releaseMissingJobs освобождает задания, которые воркер больше не выполняет,
+// хотя о завершении не сообщил. Если результаты уже загружены, задание
+// считается успешным, иначе возвращается в очередь.
+func releaseMissingJobs(workerID int, running []int) error {
+	missing, err := db.MissingWorkerJobs(workerID, running, jobs.WorkerTimeout)
+	if err != nil {
+		return err
+	}
+	for _, job := range missing {
+		if uploaded(job, filepath.Join(jobs.Default.ResultsDir, job.Tag)) {
+			log.Printf("Задание %d: воркер %d не сообщил о завершении, результаты загружены", job.ID, workerID)
+			err = db.FinishJob(job.ID, db.JobSucceeded, nil, "")
+		} else {
+			log.Printf("Задание %d пропало с воркера %d, возвращаем в очередь", job.ID, workerID)
+			err = db.RequeueJob(job.ID, "воркер не сообщил о завершении")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		jobs.Notify()
+	}
+	return nil
+}
+
+// POST /api/v1/workers/{id}/lease
+func LeaseJobHandler(w http.ResponseWriter, r *http.Request) {
+	worker, ok := loadWorker(w, r)
+	if !ok {
+		return
+	}
+	if err := db.TouchWorker(worker.ID); err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job, err := db.ClaimJob(worker.Capacity, worker.ID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	limits := jobs.Default.LimitsFor(job)
+	helpers.WriteJSONResponse(w, workerapi.Lease{
+		JobID:                job.ID,
+		Tag:                  job.Tag,
+		Args:                 job.Args,
+		CPUs:                 limits.CPUs,
+		MemoryMB:             limits.MemoryMB,
+		TimeoutSeconds:       limits.TimeoutSeconds,
+		Image:                jobs.ImageFor(job),
+		FeasibilityTolerance: db.FeasibilityTolerance,
+	}, http.StatusOK)
+}
+
+// POST /api/v1/workers/{id}/jobs/{job_id}/started
+func WorkerJobStartedHandler(w http.ResponseWriter, r *http.Request) {
+	worker, job, ok := loadWorkerJob(w, r)
+	if !ok {
+		return
+	}
+	var req workerapi.StartedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	active, err := db.SetJobContainer(job.ID, worker.Name+"/"+req.ContainerID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !active {
+		helpers.WriteErrorResponse(w, "Задание больше не выполняется", http.StatusConflict)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+// POST /api/v1/workers/{id}/jobs/{job_id}/results
+//
+// Файлы сначала пишутся во временную папку, затем она атомарно
+// переименовывается в results/<tag>, чтобы сканер не увидел частичную загрузку.
+func UploadJobResultsHandler(w http.ResponseWriter, r *http.Request) {
+	_, job, ok := loadWorkerJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != db.JobRunning {
+		helpers.WriteErrorResponse(w, "Задание больше не выполняется", http.StatusConflict)
+		return
+	}
+
+	dst := filepath.Join(jobs.Default.ResultsDir, job.Tag)
+	if uploaded(job, dst) {
+		helpers.WriteErrorResponse(w, "Результаты задания уже загружены", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxResultsUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка загрузки файлов: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Папка без results.json осталась от неудачной попытки с тем же тегом.
+	if err := os.RemoveAll(dst); err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка удаления предыдущей попытки: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmp := dst + db.UploadSuffix
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		helpers.WriteErrorResponse(w, "Не удалось создать директорию", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, name := range workerapi.ResultFiles {
+		file, _, err := r.FormFile(name)
+		if err == http.ErrMissingFile {
+			continue
+		}
+		if err != nil {
+			helpers.WriteErrorResponse(w, "Ошибка загрузки файла "+name, http.StatusBadRequest)
+			return
+		}
+		err = saveUploadedFile(file, filepath.Join(tmp, name))
+		file.Close()
+		if err != nil {
+			helpers.WriteErrorResponse(w, "Ошибка сохранения файла "+name, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		helpers.WriteErrorResponse(w, "Ошибка сохранения результатов: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+// uploaded сообщает, что результаты задания уже приняты: лежат в dst,
+// загружены в БД или папка уже переименована в .processed. Повторная загрузка
+// в таком случае привела бы к карантину дубликата.
+func uploaded(job *db.Job, dst string) bool {
+	if job.ResultID != "" {
+		return true
+	}
+	for _, path := range []string{filepath.Join(dst, db.ResultsFile), dst + db.ProcessedSuffix} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// POST /api/v1/workers/{id}/jobs/{job_id}/complete
+func CompleteWorkerJobHandler(w http.ResponseWriter, r *http.Request) {
+	_, job, ok := loadWorkerJob(w, r)
+	if !ok {
+		return
+	}
+	var req workerapi.CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		helpers.WriteErrorResponse(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	tail := req.LogTail
+	if tail == "" {
+		tail = req.Error
+	}
+	var err error
+	switch {
+	case req.TimedOut:
+		err = db.FinishJob(job.ID, db.JobTimedOut, nil, tail)
+	case req.ExitCode != nil && *req.ExitCode == 0:
+		err = db.FinishJob(job.ID, db.JobSucceeded, req.ExitCode, "")
+	default:
+		var runErr error
+		if req.Transient {
+			runErr = runner.ErrUnavailable
+		}
+		_, err = jobs.Default.Fail(job, req.ExitCode, runErr, tail)
+	}
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobs.Notify()
+	helpers.WriteJSONResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+// GET /api/v1/workers
+func ListWorkersHandler(w http.ResponseWriter, r *http.Request) {
+	workers, err := db.GetAllWorkers()
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helpers.WriteJSONResponse(w, workers, http.StatusOK)
+}
+
+func loadWorker(w http.ResponseWriter, r *http.Request) (*db.Worker, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID воркера", http.StatusBadRequest)
+		return nil, false
+	}
+	worker, err := db.GetWorker(id)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if worker == nil {
+		helpers.WriteErrorResponse(w, "Воркер не зарегистрирован", http.StatusNotFound)
+		return nil, false
+	}
+	return worker, true
+}
+
+// loadWorkerJob загружает задание из пути запроса и проверяет, что оно выдано этому воркеру.
+func loadWorkerJob(w http.ResponseWriter, r *http.Request) (*db.Worker, *db.Job, bool) {
+	worker, ok := loadWorker(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	jobID, err := strconv.Atoi(mux.Vars(r)["job_id"])
+	if err != nil {
+		helpers.WriteErrorResponse(w, "Неверный ID задания", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	job, err := db.GetJobByID(jobID)
+	if err != nil {
+		helpers.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if job == nil || job.WorkerID != worker.ID {
+		helpers.WriteErrorResponse(w, "Задание не выдано этому воркеру", http.StatusConflict)
+		return nil, nil, false
+	}
+	return worker, job, true
+}
+
+func saveUploadedFile(src io.Reader, path string) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
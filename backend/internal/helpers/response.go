@@ -31,14 +31,20 @@ func WriteJSONResponse(w http.ResponseWriter, data interface{}, statusCode int,
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-func WriteErrorResponse(w http.ResponseWriter, errMsg string, statusCode int) {
+func WriteErrorResponse(w http.ResponseWriter, errMsg string, statusCode int, meta ...map[string]interface{}) {
+	finalMeta := map[string]interface{}{
+		"message":   errMsg,
+		"timestamp": time.Now().UTC(),
+	}
+	if len(meta) > 0 {
+		for key, value := range meta[0] {
+			finalMeta[key] = value
+		}
+	}
 	resp := APIResponse{
 		Success: false,
 		Data:    nil,
-		Meta: map[string]interface{}{
-			"message":   errMsg,
-			"timestamp": time.Now().UTC(),
-		},
+		Meta:    finalMeta,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
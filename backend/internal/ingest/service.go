@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+const (
+	DefaultScanInterval = 5 * time.Minute
+	// PollInterval — интервал сканирования, когда уведомления файловой системы недоступны.
+	PollInterval = 10 * time.Second
+)
+
+// Service загружает результаты запусков из Dir. Папка загружается по
+// уведомлению файловой системы, как только в ней появился results.json;
+// полное сканирование каждые ScanInterval подбирает пропущенные события.
+type Service struct {
+	Dir          string
+	ScanInterval time.Duration
+
+	wg sync.WaitGroup
+}
+
+func NewService(dir string, scanInterval time.Duration) *Service {
+	if scanInterval <= 0 {
+		scanInterval = DefaultScanInterval
+	}
+	return &Service{Dir: dir, ScanInterval: scanInterval}
+}
+
+// Start запускает наблюдение и сканирование, которые работают, пока не отменён ctx.
+func (s *Service) Start(ctx context.Context) {
+	interval := s.ScanInterval
+	w, err := newWatcher(s.Dir)
+	if err != nil {
+		log.Printf("Уведомления о результатах недоступны, папка %s сканируется каждые %v: %v", s.Dir, PollInterval, err)
+		if interval > PollInterval {
+			interval = PollInterval
+		}
+	} else {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := w.run(ctx, db.IngestResultsDir, s.scan); err != nil {
+				log.Printf("Наблюдение за папкой %s остановлено: %v", s.Dir, err)
+			}
+		}()
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// Первое сканирование подбирает результаты, записанные до запуска.
+		for {
+			s.scan()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait ждёт, пока после отмены контекста завершится текущая загрузка.
+func (s *Service) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Service) scan() {
+	if err := db.ScanResultsFolder(s.Dir); err != nil {
+		log.Printf("Ошибка при сканировании: %v", err)
+	}
+}
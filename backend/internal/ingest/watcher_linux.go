@@ -0,0 +1,198 @@
+//go:build linux
+
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+const (
+	// В корне отслеживаются появление и исчезновение папок запусков.
+	rootMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE |
+		syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+	// results.json готов, когда его переименовали в папку или закрыли после записи.
+	runMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+)
+
+// watcher следит через inotify за корнем результатов и каждой необработанной папкой запуска.
+type watcher struct {
+	file   *os.File
+	root   string
+	rootWd int32
+	dirs   map[int32]string
+	wds    map[string]int32
+}
+
+func newWatcher(root string) (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка inotify_init: %v", err)
+	}
+	// Неблокирующий дескриптор попадает в планировщик Go, и Close прерывает Read.
+	w := &watcher{
+		file: os.NewFile(uintptr(fd), "inotify"),
+		root: root,
+		dirs: make(map[int32]string),
+		wds:  make(map[string]int32),
+	}
+	if w.rootWd, err = w.addWatch(root, rootMask); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		w.file.Close()
+		return nil, fmt.Errorf("ошибка чтения папки %s: %v", root, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() && !db.SkipResultsDir(e.Name()) {
+			w.watchRun(filepath.Join(root, e.Name()))
+		}
+	}
+	return w, nil
+}
+
+// run читает события, пока не отменён ctx. ingest вызывается для папки с
+// готовым results.json, rescan — если очередь событий переполнилась.
+func (w *watcher) run(ctx context.Context, ingest func(string), rescan func()) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		w.file.Close()
+	}()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ошибка чтения событий inotify: %v", err)
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			size := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			off += syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[off:off+size]), "\x00")
+			off += size
+			if err := w.handle(wd, mask, name, ingest, rescan); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *watcher) handle(wd int32, mask uint32, name string, ingest func(string), rescan func()) error {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		log.Printf("Очередь событий inotify переполнена, папка %s сканируется заново", w.root)
+		rescan()
+		return nil
+	}
+	if wd == w.rootWd {
+		if mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0 {
+			return fmt.Errorf("папка %s удалена или перемещена", w.root)
+		}
+		if mask&syscall.IN_ISDIR == 0 {
+			return nil
+		}
+		dir := filepath.Join(w.root, name)
+		if mask&(syscall.IN_MOVED_FROM|syscall.IN_DELETE) != 0 {
+			w.unwatchRun(dir)
+			return nil
+		}
+		if db.SkipResultsDir(name) {
+			return nil
+		}
+		// Папка загрузки воркера переименовывается уже с results.json, а
+		// локальный запуск мог записать его до того, как папку начали отслеживать.
+		w.watchRun(dir)
+		if _, err := os.Stat(filepath.Join(dir, db.ResultsFile)); err == nil {
+			ingest(dir)
+		}
+		return nil
+	}
+
+	dir, ok := w.dirs[wd]
+	if !ok {
+		return nil
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		delete(w.wds, dir)
+		return nil
+	}
+	if name == db.ResultsFile && mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0 {
+		ingest(dir)
+	}
+	return nil
+}
+
+func (w *watcher) watchRun(dir string) {
+	if _, ok := w.wds[dir]; ok {
+		return
+	}
+	wd, err := w.addWatch(dir, runMask)
+	if err != nil {
+		if !errors.Is(err, syscall.ENOENT) {
+			log.Printf("%v", err)
+		}
+		return
+	}
+	w.dirs[wd] = dir
+	w.wds[dir] = wd
+}
+
+func (w *watcher) unwatchRun(dir string) {
+	wd, ok := w.wds[dir]
+	if !ok {
+		return
+	}
+	delete(w.dirs, wd)
+	delete(w.wds, dir)
+	_ = w.control(func(fd int) error {
+		_, err := syscall.InotifyRmWatch(fd, uint32(wd))
+		return err
+	})
+}
+
+func (w *watcher) addWatch(path string, mask uint32) (int32, error) {
+	var wd int
+	err := w.control(func(fd int) error {
+		var err error
+		wd, err = syscall.InotifyAddWatch(fd, path, mask)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка наблюдения за папкой %s: %w", path, err)
+	}
+	return int32(wd), nil
+}
+
+// control вызывает f с дескриптором inotify, который не закроется во время вызова.
+func (w *watcher) control(f func(fd int) error) error {
+	conn, err := w.file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := conn.Control(func(fd uintptr) { ferr = f(int(fd)) }); err != nil {
+		return err
+	}
+	return ferr
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package ingest
+
+import (
+	"context"
+	"errors"
+)
+
+type watcher struct{}
+
+func newWatcher(string) (*watcher, error) {
+	return nil, errors.New("inotify поддерживается только в Linux")
+}
+
+func (w *watcher) run(context.Context, func(string), func()) error {
+	return nil
+}
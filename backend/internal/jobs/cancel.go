@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+// Cancel отменяет задание: из очереди оно просто снимается, у выполняющегося
+// останавливается прогон. Возвращает false, если задание уже завершилось.
+func (p *Pool) Cancel(ctx context.Context, job *db.Job, message string) (bool, error) {
+	prev, err := db.CancelJob(job.ID, message)
+	if err != nil || prev == "" {
+		return false, err
+	}
+	if prev == db.JobRunning {
+		// Удалённый воркер узнает об отмене из ответа на heartbeat.
+		if job.WorkerID == 0 {
+			if err := p.Runner.Stop(ctx, p.handleFor(job)); err != nil {
+				return true, err
+			}
+		}
+		p.setAsideResults(job.Tag)
+	}
+	return true, nil
+}
+
+// setAsideResults переименовывает папку отменённого прогона, чтобы
+// сканер не загрузил частичный результат как обычный.
+func (p *Pool) setAsideResults(tag string) {
+	src := filepath.Join(p.ResultsDir, tag)
+	if _, err := os.Stat(src); err != nil {
+		return
+	}
+	if err := os.Rename(src, src+db.CancelledSuffix); err != nil {
+		log.Printf("Ошибка переименования %s: %v", src, err)
+	}
+}
@@ -0,0 +1,336 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+)
+
+const (
+	DefaultWorkers      = 2
+	DefaultPollInterval = 5 * time.Second
+	errorTailLines      = 50
+)
+
+// Pool выбирает задания из таблицы jobs и выполняет их через Runner.
+// Число одновременных прогонов бэкенда ограничено MaxRunning по всей таблице,
+// поэтому лимит соблюдается и при нескольких экземплярах бэкенда. Задания
+// удалённых воркеров в этот лимит не входят, их ограничивает capacity воркера.
+type Pool struct {
+	Runner       runner.Runner
+	ResultsDir   string
+	Workers      int
+	MaxRunning   int
+	PollInterval time.Duration
+	// Limits применяются ко всем прогонам; метод может переопределить их в optimization_methods.limits.
+	Limits db.ResourceLimits
+	// Retry — политика повторов по умолчанию; метод может переопределить её в optimization_methods.retry_policy.
+	Retry db.RetryPolicy
+	// Retention — сколько хранить остановленные контейнеры, OrphanPolicy —
+	// что делать с контейнерами без задания. См. reconcile.go.
+	Retention         time.Duration
+	OrphanPolicy      string
+	ReconcileInterval time.Duration
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	watched map[int]bool
+	adopted map[string]bool
+}
+
+var Default *Pool
+
+func NewPool(r runner.Runner, resultsDir string, workers, maxRunning int) *Pool {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if maxRunning <= 0 {
+		maxRunning = workers
+	}
+	return &Pool{
+		Runner:            r,
+		ResultsDir:        resultsDir,
+		Workers:           workers,
+		MaxRunning:        maxRunning,
+		PollInterval:      DefaultPollInterval,
+		Retention:         DefaultRetention,
+		OrphanPolicy:      OrphanAdopt,
+		ReconcileInterval: DefaultReconcileInterval,
+		wake:              make(chan struct{}, 1),
+		watched:           make(map[int]bool),
+		adopted:           make(map[string]bool),
+	}
+}
+
+// Notify будит один из простаивающих воркеров после постановки задания в очередь.
+func Notify() {
+	if Default == nil {
+		return
+	}
+	select {
+	case Default.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start возобновляет наблюдение за заданиями, оставшимися в running после
+// перезапуска, и запускает воркеры и сверку контейнеров. Всё это
+// останавливается при отмене ctx.
+func (p *Pool) Start(ctx context.Context) error {
+	switch p.OrphanPolicy {
+	case OrphanAdopt, OrphanKill:
+	default:
+		return fmt.Errorf("неизвестная политика для контейнеров без задания %q", p.OrphanPolicy)
+	}
+	running, err := db.GetJobsByStatus(db.JobRunning)
+	if err != nil {
+		return err
+	}
+	for _, j := range running {
+		j := j
+		if j.WorkerID != 0 {
+			// За заданиями удалённых воркеров следит StartWorkerReaper.
+			continue
+		}
+		if j.ContainerID == "" {
+			log.Printf("Задание %d не было запущено, возвращаем в очередь", j.ID)
+			if err := db.RequeueJob(j.ID, "задание не было запущено до перезапуска"); err != nil {
+				log.Printf("%v", err)
+			}
+			continue
+		}
+		p.resume(ctx, &j)
+	}
+
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.worker(ctx)
+		}()
+	}
+
+	if inv, ok := p.Runner.(runner.Inventory); ok {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.reconcileLoop(ctx, inv)
+		}()
+	}
+	return nil
+}
+
+// Wait дожидается остановки всех воркеров.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) worker(ctx context.Context) {
+	ticker := time.NewTicker(p.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := db.ClaimJob(p.MaxRunning, 0)
+		if err != nil {
+			log.Printf("Ошибка выборки задания: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+		p.run(ctx, job)
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job *db.Job) {
+	p.track(job.ID)
+	defer p.untrack(job.ID)
+	limits := p.LimitsFor(job)
+	handle, err := p.Runner.Run(ctx, runner.Spec{
+		Tag:  job.Tag,
+		Args: job.Args,
+		Limits: runner.Limits{
+			CPUs:     limits.CPUs,
+			MemoryMB: limits.MemoryMB,
+		},
+		Image:                ImageFor(job),
+		FeasibilityTolerance: db.FeasibilityTolerance,
+	})
+	if err != nil {
+		log.Printf("Задание %d: %v", job.ID, err)
+		if ctx.Err() != nil {
+			_ = db.RequeueJob(job.ID, "остановка бэкенда")
+			return
+		}
+		if _, err := p.Fail(job, nil, err, err.Error()); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+	active, err := db.SetJobContainer(job.ID, handle.ID)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	if err == nil && !active {
+		log.Printf("Задание %d отменено во время запуска", job.ID)
+		if err := p.Runner.Stop(context.Background(), handle); err != nil {
+			log.Printf("Задание %d: %v", job.ID, err)
+		}
+		p.setAsideResults(job.Tag)
+		return
+	}
+	log.Printf("Задание %d запущено: %s", job.ID, handle.Name)
+	p.wait(ctx, job, handle, limits)
+}
+
+// LimitsFor объединяет лимиты по умолчанию с переопределениями метода задания.
+func (p *Pool) LimitsFor(job *db.Job) db.ResourceLimits {
+	method, err := db.GetOptimizationMethodByID(job.MethodID)
+	if err != nil {
+		log.Printf("Задание %d: %v, применяются лимиты по умолчанию", job.ID, err)
+		return p.Limits
+	}
+	return p.Limits.Merge(method.Limits)
+}
+
+// ImageFor возвращает собранный образ метода задания или пустую строку,
+// если прогон должен идти в образе раннера по умолчанию.
+func ImageFor(job *db.Job) string {
+	method, err := db.GetOptimizationMethodByID(job.MethodID)
+	if err != nil {
+		log.Printf("Задание %d: %v, используется образ по умолчанию", job.ID, err)
+		return ""
+	}
+	return method.Image
+}
+
+func (p *Pool) wait(ctx context.Context, job *db.Job, handle *runner.Handle, limits db.ResourceLimits) {
+	waitCtx := ctx
+	if limits.TimeoutSeconds > 0 {
+		started := time.Now()
+		if job.StartedAt != nil {
+			started = *job.StartedAt
+		}
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithDeadline(ctx, started.Add(time.Duration(limits.TimeoutSeconds)*time.Second))
+		defer cancel()
+	}
+
+	code, err := p.Runner.Wait(waitCtx, handle)
+	if ctx.Err() != nil {
+		// Бэкенд останавливается: задание останется в running и будет
+		// подхвачено при следующем запуске.
+		return
+	}
+	if waitCtx.Err() == context.DeadlineExceeded {
+		log.Printf("Задание %d превысило лимит времени %d с", job.ID, limits.TimeoutSeconds)
+		tail := p.logTail(handle)
+		if err := p.Runner.Stop(context.Background(), handle); err != nil {
+			log.Printf("Задание %d: %v", job.ID, err)
+		}
+		if err := db.FinishJob(job.ID, db.JobTimedOut, nil, tail); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+
+	var exitCode *int
+	runErr := err
+	tail := ""
+	switch {
+	case errors.Is(err, runner.ErrLost):
+		log.Printf("Задание %d: прогон %s потерян", job.ID, handle.Name)
+		tail = err.Error()
+	case err != nil:
+		log.Printf("Задание %d: ошибка ожидания: %v", job.ID, err)
+		tail = err.Error()
+	case code == 0:
+		if err := db.FinishJob(job.ID, db.JobSucceeded, &code, ""); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	default:
+		log.Printf("Задание %d завершилось с кодом %d", job.ID, code)
+		exitCode = &code
+		tail = p.logTail(handle)
+	}
+
+	retried, err := p.Fail(job, exitCode, runErr, tail)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	if retried {
+		// Следующая попытка создаст контейнер с тем же именем.
+		if err := p.Runner.Stop(context.Background(), handle); err != nil {
+			log.Printf("Задание %d: %v", job.ID, err)
+		}
+	}
+}
+
+// resume возобновляет наблюдение за прогоном задания, если пул за ним ещё не следит.
+func (p *Pool) resume(ctx context.Context, job *db.Job) {
+	if !p.track(job.ID) {
+		return
+	}
+	limits := p.LimitsFor(job)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.untrack(job.ID)
+		p.wait(ctx, job, p.handleFor(job), limits)
+	}()
+}
+
+// track отмечает, что пул следит за заданием; false — уже следит.
+func (p *Pool) track(id int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.watched[id] {
+		return false
+	}
+	p.watched[id] = true
+	return true
+}
+
+func (p *Pool) untrack(id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.watched, id)
+}
+
+func (p *Pool) tracked(id int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.watched[id]
+}
+
+// logTail возвращает последние строки лога упавшего прогона.
+func (p *Pool) logTail(handle *runner.Handle) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return runner.LogTail(ctx, p.Runner, handle.Name, errorTailLines)
+}
+
+func (p *Pool) handleFor(job *db.Job) *runner.Handle {
+	return &runner.Handle{
+		ID:   job.ContainerID,
+		Name: job.ContainerName,
+		Tag:  job.Tag,
+	}
+}
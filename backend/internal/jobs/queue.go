@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+// Estimate заполняет позицию задания в очереди и ожидаемое время старта.
+// Оценка считает, что слоты MaxRunning и активных воркеров освобождаются
+// волнами со средней длительностью недавних прогонов; без истории время
+// старта не заполняется.
+func (p *Pool) Estimate(job *db.Job) error {
+	if job.Status != db.JobQueued {
+		return nil
+	}
+	order, running, err := db.QueueOrder()
+	if err != nil {
+		return err
+	}
+	pos := -1
+	for i, id := range order {
+		if id == job.ID {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil
+	}
+	position := pos + 1
+	job.QueuePosition = &position
+
+	slots := p.MaxRunning
+	workers, err := db.GetAllWorkers()
+	if err != nil {
+		return err
+	}
+	for _, w := range workers {
+		if w.Status == db.WorkerOnline {
+			slots += w.Capacity
+		}
+	}
+
+	start := time.Now()
+	if free := slots - running; pos >= free {
+		avg, err := db.AverageRunDuration()
+		if err != nil {
+			return err
+		}
+		if avg == 0 {
+			return nil
+		}
+		if free < 0 {
+			free = 0
+		}
+		waves := (pos-free)/slots + 1
+		start = start.Add(time.Duration(waves) * avg)
+	}
+	if job.NotBefore != nil && job.NotBefore.After(start) {
+		start = *job.NotBefore
+	}
+	job.EstimatedStart = &start
+	return nil
+}
@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+)
+
+const (
+	// OrphanAdopt оставляет контейнер без задания работать до конца, а затем
+	// удаляет его, как обычный завершённый. OrphanKill удаляет такой контейнер сразу.
+	OrphanAdopt = "adopt"
+	OrphanKill  = "kill"
+
+	DefaultRetention         = 24 * time.Hour
+	DefaultReconcileInterval = time.Minute
+)
+
+// reconcileLoop сверяет прогоны раннера с таблицей jobs при старте и затем
+// каждые ReconcileInterval.
+func (p *Pool) reconcileLoop(ctx context.Context, inv runner.Inventory) {
+	ticker := time.NewTicker(p.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.reconcile(ctx, inv); err != nil && ctx.Err() == nil {
+			log.Printf("Ошибка сверки контейнеров: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile сопоставляет контейнеры с заданиями по имени. За выполняющимися
+// заданиями, которые пул потерял, наблюдение возобновляется, контейнеры
+// завершённых заданий удаляются по истечении Retention. Задания в running,
+// чей контейнер пропал, завершаются как упавшие с учётом политики повторов.
+func (p *Pool) reconcile(ctx context.Context, inv runner.Inventory) error {
+	list, err := inv.List(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(list))
+	for i := range list {
+		inst := &list[i]
+		seen[inst.ID] = true
+		job, err := db.GetJobByContainerName(inst.Name)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		p.reconcileInstance(ctx, inst, job)
+	}
+
+	running, err := db.GetJobsByStatus(db.JobRunning)
+	if err != nil {
+		return err
+	}
+	for i := range running {
+		job := &running[i]
+		if job.WorkerID != 0 || job.ContainerID == "" || seen[job.ContainerID] || p.tracked(job.ID) {
+			continue
+		}
+		log.Printf("Задание %d: контейнер %s пропал", job.ID, job.ContainerName)
+		if _, err := p.Fail(job, nil, runner.ErrLost, "контейнер пропал"); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	return nil
+}
+
+func (p *Pool) reconcileInstance(ctx context.Context, inst *runner.Instance, job *db.Job) {
+	switch {
+	case job == nil:
+		p.reconcileOrphan(ctx, inst)
+	case job.WorkerID != 0:
+		// Прогоном на этом же Docker управляет удалённый воркер.
+	case job.Status == db.JobRunning && (job.ContainerID == "" || p.tracked(job.ID)):
+		// Прогон запускается или за ним уже следит пул.
+	case job.Status == db.JobRunning && job.ContainerID == inst.ID:
+		log.Printf("Задание %d: возобновляем наблюдение за %s", job.ID, inst.Name)
+		p.resume(ctx, job)
+	case job.Status == db.JobQueued:
+		// Иначе следующая попытка не сможет создать контейнер с тем же именем.
+		log.Printf("Задание %d снова в очереди, удаляем контейнер прошлой попытки %s", job.ID, inst.Name)
+		p.removeInstance(ctx, inst)
+	case inst.Running:
+		log.Printf("Задание %d в статусе %s, удаляем его контейнер %s", job.ID, job.Status, inst.Name)
+		p.removeInstance(ctx, inst)
+	default:
+		p.expire(ctx, inst)
+	}
+}
+
+func (p *Pool) reconcileOrphan(ctx context.Context, inst *runner.Instance) {
+	if p.OrphanPolicy == OrphanKill {
+		log.Printf("Контейнер %s не относится ни к одному заданию, удаляем", inst.Name)
+		p.removeInstance(ctx, inst)
+		return
+	}
+	if !inst.Running {
+		p.expire(ctx, inst)
+		return
+	}
+	p.mu.Lock()
+	first := !p.adopted[inst.ID]
+	p.adopted[inst.ID] = true
+	p.mu.Unlock()
+	if first {
+		log.Printf("Контейнер %s не относится ни к одному заданию, оставляем до завершения", inst.Name)
+	}
+}
+
+// expire удаляет остановленный контейнер, если он хранится дольше Retention.
+func (p *Pool) expire(ctx context.Context, inst *runner.Instance) {
+	if time.Since(inst.FinishedAt) < p.Retention {
+		return
+	}
+	p.removeInstance(ctx, inst)
+}
+
+// removeInstance сохраняет лог прогона рядом с результатами и удаляет контейнер.
+func (p *Pool) removeInstance(ctx context.Context, inst *runner.Instance) {
+	if err := runner.SaveLog(ctx, p.Runner, p.ResultsDir, &inst.Handle); err != nil {
+		log.Printf("%v", err)
+	}
+	if err := p.Runner.Stop(ctx, &inst.Handle); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	p.mu.Lock()
+	delete(p.adopted, inst.ID)
+	p.mu.Unlock()
+}
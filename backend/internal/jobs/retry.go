@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+)
+
+// Transient сообщает, стоит ли повторять упавший прогон. exitCode равен nil,
+// если прогон не дошёл до завершения run.py из-за ошибки раннера runErr;
+// повторяются только ошибки, отмеченные runner.ErrUnavailable. Пропавший
+// прогон (runner.ErrLost) не повторяется: его процесс может ещё писать в ту
+// же папку. Код 1 run.py возвращает, когда не смог загрузить задачу или
+// алгоритм, такие прогоны не повторяются. Процессы, убитые сигналом (в том
+// числе OOM killer, код 137), считаются временным сбоем.
+func Transient(exitCode *int, runErr error) bool {
+	if exitCode == nil {
+		return errors.Is(runErr, runner.ErrUnavailable)
+	}
+	return *exitCode < 0 || *exitCode >= 128
+}
+
+// RetryFor объединяет политику повторов по умолчанию с политикой метода задания.
+func (p *Pool) RetryFor(job *db.Job) db.RetryPolicy {
+	method, err := db.GetOptimizationMethodByID(job.MethodID)
+	if err != nil {
+		log.Printf("Задание %d: %v, применяется политика повторов по умолчанию", job.ID, err)
+		return p.Retry
+	}
+	return p.Retry.Merge(method.Retry)
+}
+
+// Fail завершает попытку задания с ошибкой. Если сбой временный и попытки не
+// исчерпаны, задание возвращается в очередь с экспоненциальной задержкой.
+// Возвращает true, если задание будет повторено.
+func (p *Pool) Fail(job *db.Job, exitCode *int, runErr error, errorTail string) (bool, error) {
+	policy := p.RetryFor(job)
+	if !Transient(exitCode, runErr) || job.Attempt >= policy.MaxAttempts {
+		return false, db.FinishJob(job.ID, db.JobFailed, exitCode, errorTail)
+	}
+	delay := policy.Backoff(job.Attempt)
+	log.Printf("Задание %d: попытка %d из %d не удалась, повтор через %v",
+		job.ID, job.Attempt, policy.MaxAttempts, delay)
+	return true, db.RetryJob(job.ID, exitCode, errorTail, delay)
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/axywe/distributed-benchmarks/internal/runner"
+)
+
+func TestTransient(t *testing.T) {
+	code := func(c int) *int { return &c }
+	tests := []struct {
+		name     string
+		exitCode *int
+		runErr   error
+		want     bool
+	}{
+		{"runner unavailable", nil, &runner.RunError{Stage: "create", Err: fmt.Errorf("%w: dial", runner.ErrUnavailable)}, true},
+		{"lost run", nil, &runner.RunError{Stage: "wait", Err: runner.ErrLost}, false},
+		{"other runner error", nil, &runner.RunError{Stage: "create", Err: errors.New("no such image")}, false},
+		{"no error", nil, nil, false},
+		{"success", code(0), nil, false},
+		{"load failure", code(1), nil, false},
+		{"oom killed", code(137), nil, true},
+		{"signal", code(-1), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Transient(tt.exitCode, tt.runErr); got != tt.want {
+				t.Errorf("Transient = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+const DefaultWorkerTimeout = time.Minute
+
+// WorkerTimeout — время без heartbeat, после которого воркер считается потерянным.
+var WorkerTimeout = DefaultWorkerTimeout
+
+// StartWorkerReaper периодически помечает потерянными удалённые воркеры без
+// heartbeat дольше timeout и возвращает их задания в очередь.
+func StartWorkerReaper(ctx context.Context, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultWorkerTimeout
+	}
+	WorkerTimeout = timeout
+	ticker := time.NewTicker(timeout / 3)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			lost, err := db.MarkLostWorkers(timeout)
+			if err != nil {
+				log.Printf("%v", err)
+				continue
+			}
+			for _, id := range lost {
+				log.Printf("Воркер %d потерян, его задания возвращаются в очередь", id)
+				if err := db.RequeueWorkerJobs(id, "воркер потерян"); err != nil {
+					log.Printf("%v", err)
+				}
+			}
+			if len(lost) > 0 {
+				Notify()
+			}
+		}
+	}()
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/axywe/distributed-benchmarks/internal/helpers"
+	"github.com/axywe/distributed-benchmarks/internal/workerapi"
+)
+
+// WorkerMiddleware пропускает только удалённые воркеры, знающие WORKER_TOKEN.
+// Без заданного токена API воркеров отключено.
+func WorkerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := os.Getenv("WORKER_TOKEN")
+		if expected == "" {
+			helpers.WriteErrorResponse(w, "API воркеров отключено", http.StatusForbidden)
+			return
+		}
+		token := r.Header.Get(workerapi.TokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			helpers.WriteErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
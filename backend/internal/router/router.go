@@ -21,8 +21,13 @@ func NewRouter() *mux.Router {
 
 	// Public API
 	api.HandleFunc("/optimization", handlers.OptimizationPostHandler).Methods("POST")
+	api.HandleFunc("/optimization/plan", handlers.OptimizationPlanHandler).Methods("POST")
 	api.HandleFunc("/optimization/results/{id}", handlers.OptimizationResultHandler).Methods("GET")
 	api.HandleFunc("/optimization/results/{id}/download", handlers.OptimizationDownloadHandler).Methods("GET")
+	api.HandleFunc("/optimization/results/{id}/reruns", handlers.ResultRerunsHandler).Methods("GET")
+	api.HandleFunc("/optimization/results/{id}/history", handlers.ResultHistoryHandler).Methods("GET")
+	api.HandleFunc("/optimization/results/{id}/pareto", handlers.ResultParetoHandler).Methods("GET")
+	api.HandleFunc("/optimization/convergence", handlers.ConvergenceHandler).Methods("POST")
 	api.HandleFunc("/optimization/logs", handlers.ContainerLogsHandler).Methods("GET")
 	api.HandleFunc("/optimization/search", handlers.SearchOptimizationResultsHandler).Methods("GET")
 
@@ -33,12 +38,39 @@ func NewRouter() *mux.Router {
 	auth.Use(middleware.AuthMiddleware)
 
 	auth.HandleFunc("/user", handlers.UserHandler).Methods("GET")
+	auth.HandleFunc("/user/usage", handlers.UserUsageHandler).Methods("GET")
+	auth.HandleFunc("/events", handlers.EventsHandler).Methods("GET")
 
 	auth.HandleFunc("/optimization/results", handlers.OptimizationResultsHandler).Methods("GET")
+	auth.HandleFunc("/optimization/results/{id}/rerun", handlers.RerunResultHandler).Methods("POST")
+	auth.HandleFunc("/optimization/hypervolume", handlers.HypervolumeHandler).Methods("POST")
+	auth.HandleFunc("/optimization/jobs", handlers.UserJobsHandler).Methods("GET")
+	auth.HandleFunc("/optimization/jobs/{id}", handlers.JobStatusHandler).Methods("GET")
+	auth.HandleFunc("/optimization/jobs/{id}", handlers.CancelJobHandler).Methods("DELETE")
+	auth.HandleFunc("/optimization/batch", handlers.OptimizationBatchHandler).Methods("POST")
+	auth.HandleFunc("/optimization/sweep", handlers.OptimizationSweepHandler).Methods("POST")
+
+	auth.HandleFunc("/experiments", handlers.CreateExperimentHandler).Methods("POST")
+	auth.HandleFunc("/experiments", handlers.ListExperimentsHandler).Methods("GET")
+	auth.HandleFunc("/experiments/{id}", handlers.GetExperimentHandler).Methods("GET")
+	auth.HandleFunc("/experiments/{id}", handlers.UpdateExperimentHandler).Methods("PUT")
+	auth.HandleFunc("/experiments/{id}/results", handlers.AttachExperimentResultsHandler).Methods("POST")
+	auth.HandleFunc("/experiments/{id}/export", handlers.ExportExperimentHandler).Methods("GET")
+	auth.HandleFunc("/experiments/{id}/convergence", handlers.ExperimentConvergenceHandler).Methods("GET")
+	auth.HandleFunc("/experiments/{id}/hypervolume", handlers.ExperimentHypervolumeHandler).Methods("GET")
+	auth.HandleFunc("/optimization/batches", handlers.UserBatchesHandler).Methods("GET")
+	auth.HandleFunc("/optimization/batches/{id}", handlers.BatchStatusHandler).Methods("GET")
+	auth.HandleFunc("/optimization/batches/{id}", handlers.CancelBatchHandler).Methods("DELETE")
+
+	auth.HandleFunc("/webhooks", handlers.CreateWebhookHandler).Methods("POST")
+	auth.HandleFunc("/webhooks", handlers.ListWebhooksHandler).Methods("GET")
+	auth.HandleFunc("/webhooks/{id}", handlers.UpdateWebhookHandler).Methods("PUT")
+	auth.HandleFunc("/webhooks/{id}", handlers.DeleteWebhookHandler).Methods("DELETE")
+	auth.HandleFunc("/webhooks/{id}/deliveries", handlers.WebhookDeliveriesHandler).Methods("GET")
 
 	// Admin API
 	admin := auth.PathPrefix("").Subrouter()
-	admin.Use(middleware.AuthMiddleware)
+	admin.Use(middleware.AdminMiddleware)
 	admin.HandleFunc("/files", handlers.ListFilesHandler).Methods("GET")
 	admin.HandleFunc("/files/upload", handlers.UploadFileHandler).Methods("POST")
 	admin.HandleFunc("/files/{path:.*}", handlers.DeleteFileHandler).Methods("DELETE")
@@ -47,6 +79,31 @@ func NewRouter() *mux.Router {
 
 	admin.HandleFunc("/methods", handlers.CreateOptimizationMethodHandler).Methods("POST")
 	admin.HandleFunc("/methods/{id}", handlers.DeleteOptimizationMethodHandler).Methods("DELETE")
+	admin.HandleFunc("/methods/{id}/limits", handlers.UpdateOptimizationMethodLimitsHandler).Methods("PUT")
+	admin.HandleFunc("/methods/{id}/retry", handlers.UpdateOptimizationMethodRetryPolicyHandler).Methods("PUT")
+	admin.HandleFunc("/methods/{id}/build", handlers.BuildMethodImageHandler).Methods("POST")
+	admin.HandleFunc("/images", handlers.ListImagesHandler).Methods("GET")
+	admin.HandleFunc("/images/{ref}", handlers.DeleteImageHandler).Methods("DELETE")
+
+	admin.HandleFunc("/workers", handlers.ListWorkersHandler).Methods("GET")
+	admin.HandleFunc("/users/{id}/weight", handlers.UpdateUserWeightHandler).Methods("PUT")
+	admin.HandleFunc("/quotas", handlers.ListQuotasHandler).Methods("GET")
+	admin.HandleFunc("/quotas/users/{id}", handlers.UpdateUserQuotaHandler).Methods("PUT")
+	admin.HandleFunc("/quotas/groups/{group}", handlers.UpdateGroupQuotaHandler).Methods("PUT")
+	admin.HandleFunc("/quarantine", handlers.ListQuarantineHandler).Methods("GET")
+	admin.HandleFunc("/quarantine/{id}", handlers.GetQuarantineHandler).Methods("GET")
+	admin.HandleFunc("/quarantine/{id}", handlers.DiscardQuarantineHandler).Methods("DELETE")
+	admin.HandleFunc("/quarantine/{id}/retry", handlers.RetryQuarantineHandler).Methods("POST")
+
+	// Remote workers API
+	workers := api.PathPrefix("/workers").Subrouter()
+	workers.Use(middleware.WorkerMiddleware)
+	workers.HandleFunc("/register", handlers.RegisterWorkerHandler).Methods("POST")
+	workers.HandleFunc("/{id}/heartbeat", handlers.WorkerHeartbeatHandler).Methods("POST")
+	workers.HandleFunc("/{id}/lease", handlers.LeaseJobHandler).Methods("POST")
+	workers.HandleFunc("/{id}/jobs/{job_id}/started", handlers.WorkerJobStartedHandler).Methods("POST")
+	workers.HandleFunc("/{id}/jobs/{job_id}/results", handlers.UploadJobResultsHandler).Methods("POST")
+	workers.HandleFunc("/{id}/jobs/{job_id}/complete", handlers.CompleteWorkerJobHandler).Methods("POST")
 
 	// Static files
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("web"))))
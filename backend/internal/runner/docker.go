@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/docker"
+)
+
+const (
+	GroupLabel          = "group"
+	GroupValue          = "boela"
+	TagLabel            = "boela.tag"
+	DefaultImage        = "boela-custom:latest"
+	DefaultNamePrefix   = "boela-docker"
+	containerResultsDir = "/results"
+	imageDigestEnv      = "BOELA_IMAGE_DIGEST"
+)
+
+type DockerRunner struct {
+	Client     *docker.Client
+	Image      string
+	NamePrefix string
+	ResultsDir string
+}
+
+func NewDockerRunner(host, image, resultsDir string) (*DockerRunner, error) {
+	client, err := docker.NewClient(host)
+	if err != nil {
+		return nil, err
+	}
+	if image == "" {
+		image = DefaultImage
+	}
+	return &DockerRunner{
+		Client:     client,
+		Image:      image,
+		NamePrefix: DefaultNamePrefix,
+		ResultsDir: resultsDir,
+	}, nil
+}
+
+func (d *DockerRunner) Name(tag string) string {
+	return d.NamePrefix + "-" + tag
+}
+
+// Run создаёт и запускает контейнер с bench/run.py, передавая аргументы как есть.
+func (d *DockerRunner) Run(ctx context.Context, spec Spec) (*Handle, error) {
+	tag := spec.Tag
+	if tag == "" {
+		tag = NewTag()
+	}
+	hostDir, err := filepath.Abs(filepath.Join(d.ResultsDir, tag))
+	if err != nil {
+		return nil, &RunError{Stage: "prepare", Err: err}
+	}
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		return nil, &RunError{Stage: "prepare", Err: err}
+	}
+
+	image := spec.Image
+	if image == "" {
+		image = d.Image
+	}
+	digest, err := d.imageDigest(ctx, image)
+	if err != nil {
+		os.Remove(hostDir)
+		return nil, dockerError("create", err)
+	}
+	memory := int64(spec.Limits.MemoryMB) << 20
+	name := d.Name(tag)
+	id, err := d.Client.CreateContainer(ctx, name, docker.ContainerConfig{
+		Image:  image,
+		Cmd:    spec.Args,
+		Env:    []string{imageDigestEnv + "=" + digest, spec.toleranceEnv()},
+		Labels: map[string]string{GroupLabel: GroupValue, TagLabel: tag},
+		HostConfig: docker.HostConfig{
+			Binds:    []string{hostDir + ":" + containerResultsDir},
+			NanoCPUs: int64(spec.Limits.CPUs * 1e9),
+			Memory:   memory,
+			// Без swap лимит памяти действительно ограничивает контейнер.
+			MemorySwap: memory,
+		},
+	})
+	if err != nil {
+		os.Remove(hostDir)
+		return nil, dockerError("create", err)
+	}
+
+	if err := d.Client.StartContainer(ctx, id); err != nil {
+		_ = d.Client.RemoveContainer(context.Background(), id, true)
+		os.Remove(hostDir)
+		return nil, dockerError("start", err)
+	}
+
+	return &Handle{
+		ID:         id,
+		Name:       name,
+		Tag:        tag,
+		ResultsDir: filepath.Join(d.ResultsDir, tag),
+	}, nil
+}
+
+// imageDigest возвращает дайджест образа из реестра, а для локально
+// собранных образов — его ID. run.py записывает его в results.json.
+func (d *DockerRunner) imageDigest(ctx context.Context, image string) (string, error) {
+	info, err := d.Client.InspectImage(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if len(info.RepoDigests) > 0 {
+		return info.RepoDigests[0], nil
+	}
+	return info.ID, nil
+}
+
+func (d *DockerRunner) Wait(ctx context.Context, h *Handle) (int, error) {
+	code, err := d.Client.WaitContainer(ctx, h.ID)
+	if docker.IsNotFound(err) {
+		return 0, &RunError{Stage: "wait", Err: ErrLost}
+	}
+	if err != nil {
+		return 0, dockerError("wait", err)
+	}
+	return code, nil
+}
+
+// dockerError отмечает ошибки недоступного Docker Engine как ErrUnavailable.
+func dockerError(stage string, err error) error {
+	if docker.IsUnavailable(err) {
+		err = fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return &RunError{Stage: stage, Err: err}
+}
+
+func (d *DockerRunner) Stop(ctx context.Context, h *Handle) error {
+	ref := h.ID
+	if ref == "" {
+		ref = h.Name
+	}
+	if err := d.Client.RemoveContainer(ctx, ref, true); err != nil && !docker.IsNotFound(err) {
+		return &RunError{Stage: "stop", Err: err}
+	}
+	return nil
+}
+
+// Logs читает лог контейнера, а после его удаления — сохранённый run.log.
+func (d *DockerRunner) Logs(ctx context.Context, name string, follow bool) (io.ReadCloser, error) {
+	logs, err := d.Client.ContainerLogs(ctx, name, follow, "")
+	if docker.IsNotFound(err) {
+		if f, ferr := openRunLog(d.ResultsDir, strings.TrimPrefix(name, d.NamePrefix+"-")); ferr == nil {
+			return f, nil
+		}
+	}
+	return logs, err
+}
+
+// List возвращает все контейнеры с меткой group=boela, включая остановленные.
+func (d *DockerRunner) List(ctx context.Context) ([]Instance, error) {
+	containers, err := d.Client.ListContainers(ctx, map[string]string{GroupLabel: GroupValue})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Instance, 0, len(containers))
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(c.Names[0], "/")
+		tag := c.Labels[TagLabel]
+		if tag == "" {
+			// Контейнеры, запущенные до появления метки или через make docker.
+			tag = strings.TrimPrefix(name, d.NamePrefix+"-")
+		}
+		inst := Instance{
+			Handle: Handle{
+				ID:         c.ID,
+				Name:       name,
+				Tag:        tag,
+				ResultsDir: filepath.Join(d.ResultsDir, tag),
+			},
+			Running: c.State == "running",
+		}
+		if !inst.Running {
+			info, err := d.Client.InspectContainer(ctx, c.ID)
+			if docker.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			inst.ExitCode = info.State.ExitCode
+			// У так и не запущенного контейнера FinishedAt нулевой.
+			inst.FinishedAt, _ = time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+		}
+		list = append(list, inst)
+	}
+	return list, nil
+}
@@ -0,0 +1,196 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MethodLabel       = "boela.method"
+	HashLabel         = "boela.hash"
+	MethodImagePrefix = "boela-method"
+	// requirementsFile в папке метода устанавливается в образ через pip.
+	requirementsFile = "requirements.txt"
+)
+
+// ImageBuilder реализуют раннеры, которые умеют собирать образы методов.
+type ImageBuilder interface {
+	// BuildImage собирает образ из файлов метода и возвращает его тег.
+	// Строки лога сборки передаются в progress.
+	BuildImage(ctx context.Context, b ImageBuild, progress func(line string)) (string, error)
+	Images(ctx context.Context) ([]Image, error)
+	RemoveImage(ctx context.Context, ref string) error
+}
+
+// ImageBuild описывает образ метода: файл или папка Source копируется
+// поверх образа по умолчанию в /app/Target.
+type ImageBuild struct {
+	MethodID int
+	Source   string
+	Target   string
+}
+
+type Image struct {
+	ID       string    `json:"id"`
+	Tags     []string  `json:"tags"`
+	MethodID int       `json:"method_id,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+	Created  time.Time `json:"created"`
+	Size     int64     `json:"size"`
+}
+
+// MethodImageTag возвращает тег образа метода для хэша содержимого.
+func MethodImageTag(methodID int, hash string) string {
+	return fmt.Sprintf("%s-%d:%s", MethodImagePrefix, methodID, hash)
+}
+
+func (d *DockerRunner) BuildImage(ctx context.Context, b ImageBuild, progress func(line string)) (string, error) {
+	buildContext, hash, err := d.buildContext(b)
+	if err != nil {
+		return "", err
+	}
+	tag := MethodImageTag(b.MethodID, hash)
+	stream, err := d.Client.BuildImage(ctx, buildContext, []string{tag}, map[string]string{
+		GroupLabel:  GroupValue,
+		MethodLabel: strconv.Itoa(b.MethodID),
+		HashLabel:   hash,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	dec := json.NewDecoder(stream)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("ошибка чтения лога сборки: %v", err)
+		}
+		if msg.Error != "" {
+			return "", fmt.Errorf("ошибка сборки образа: %s", strings.TrimSpace(msg.Error))
+		}
+		for _, line := range strings.Split(msg.Stream+msg.Status, "\n") {
+			if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+				progress(line)
+			}
+		}
+	}
+	return tag, nil
+}
+
+// buildContext упаковывает Dockerfile и файлы метода в tar-архив и считает
+// хэш содержимого, по которому тегируется образ.
+func (d *DockerRunner) buildContext(b ImageBuild) (io.Reader, string, error) {
+	info, err := os.Stat(b.Source)
+	if err != nil {
+		return nil, "", err
+	}
+	target := path.Join("/app", filepath.ToSlash(b.Target))
+	dockerfile := fmt.Sprintf("FROM %s\nCOPY src %s\n", d.Image, target)
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(b.Source, requirementsFile)); err == nil {
+			dockerfile += fmt.Sprintf("RUN pip install --no-cache-dir -r %s\n", path.Join(target, requirementsFile))
+		}
+	}
+
+	files := make(map[string]string)
+	if info.IsDir() {
+		err = filepath.WalkDir(b.Source, func(p string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(b.Source, p)
+			if err != nil {
+				return err
+			}
+			files[path.Join("src", filepath.ToSlash(rel))] = p
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		files["src"] = b.Source
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	h := sha256.New()
+	io.WriteString(h, dockerfile)
+	if err := writeTarFile(tw, "Dockerfile", []byte(dockerfile)); err != nil {
+		return nil, "", err
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(files[name])
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(h, "\x00%s\x00%d\x00", name, len(data))
+		h.Write(data)
+		if err := writeTarFile(tw, name, data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Images возвращает собранные образы методов.
+func (d *DockerRunner) Images(ctx context.Context) ([]Image, error) {
+	list, err := d.Client.ListImages(ctx, map[string]string{GroupLabel: GroupValue})
+	if err != nil {
+		return nil, err
+	}
+	images := make([]Image, 0, len(list))
+	for _, img := range list {
+		methodID, _ := strconv.Atoi(img.Labels[MethodLabel])
+		images = append(images, Image{
+			ID:       img.ID,
+			Tags:     img.RepoTags,
+			MethodID: methodID,
+			Hash:     img.Labels[HashLabel],
+			Created:  time.Unix(img.Created, 0),
+			Size:     img.Size,
+		})
+	}
+	return images, nil
+}
+
+func (d *DockerRunner) RemoveImage(ctx context.Context, ref string) error {
+	return d.Client.RemoveImage(ctx, ref, false)
+}
@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPython      = "python3"
+	DefaultBenchDir    = "bench"
+	DefaultLocalPrefix = "boela-local"
+	LogFileName        = "run.log"
+	resultsDirEnv      = "BOELA_RESULTS_DIR"
+	memoryLimitEnv     = "BOELA_MEMORY_LIMIT_MB"
+)
+
+// LocalRunner запускает bench/run.py обычным процессом, без Docker.
+// Лимит памяти run.py выставляет себе сам, лимит CPU не поддерживается.
+type LocalRunner struct {
+	Python     string
+	Script     string
+	NamePrefix string
+	ResultsDir string
+
+	mu    sync.Mutex
+	procs map[string]*process
+}
+
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func NewLocalRunner(python, benchDir, resultsDir string) *LocalRunner {
+	if python == "" {
+		python = DefaultPython
+	}
+	if benchDir == "" {
+		benchDir = DefaultBenchDir
+	}
+	return &LocalRunner{
+		Python:     python,
+		Script:     filepath.Join(benchDir, "run.py"),
+		NamePrefix: DefaultLocalPrefix,
+		ResultsDir: resultsDir,
+		procs:      make(map[string]*process),
+	}
+}
+
+func (l *LocalRunner) Name(tag string) string {
+	return l.NamePrefix + "-" + tag
+}
+
+func (l *LocalRunner) Run(ctx context.Context, spec Spec) (*Handle, error) {
+	tag := spec.Tag
+	if tag == "" {
+		tag = NewTag()
+	}
+	dir := filepath.Join(l.ResultsDir, tag)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, &RunError{Stage: "prepare", Err: err}
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, &RunError{Stage: "prepare", Err: err}
+	}
+	logFile, err := os.Create(filepath.Join(absDir, LogFileName))
+	if err != nil {
+		os.RemoveAll(absDir)
+		return nil, &RunError{Stage: "prepare", Err: err}
+	}
+
+	script, err := filepath.Abs(l.Script)
+	if err != nil {
+		logFile.Close()
+		os.RemoveAll(absDir)
+		return nil, &RunError{Stage: "prepare", Err: err}
+	}
+
+	// Процесс не привязан к ctx: он должен пережить HTTP-запрос, который его запустил.
+	cmd := exec.Command(l.Python, append([]string{script}, spec.Args...)...)
+	cmd.Env = append(os.Environ(), resultsDirEnv+"="+absDir, spec.toleranceEnv())
+	if spec.Limits.MemoryMB > 0 {
+		cmd.Env = append(cmd.Env, memoryLimitEnv+"="+strconv.Itoa(spec.Limits.MemoryMB))
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		os.RemoveAll(absDir)
+		return nil, &RunError{Stage: "start", Err: err}
+	}
+
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	l.mu.Lock()
+	l.procs[tag] = p
+	l.mu.Unlock()
+	go func() {
+		p.err = cmd.Wait()
+		logFile.Close()
+		close(p.done)
+	}()
+
+	return &Handle{
+		ID:         strconv.Itoa(cmd.Process.Pid),
+		Name:       l.Name(tag),
+		Tag:        tag,
+		ResultsDir: dir,
+	}, nil
+}
+
+func (l *LocalRunner) Wait(ctx context.Context, h *Handle) (int, error) {
+	l.mu.Lock()
+	p := l.procs[h.Tag]
+	l.mu.Unlock()
+	if p == nil {
+		return 0, &RunError{Stage: "wait", Err: ErrLost}
+	}
+
+	// Прерванный по ctx прогон остаётся в procs, пока его не остановит Stop.
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	l.forget(h.Tag, p)
+	if p.cmd.ProcessState == nil {
+		return 0, &RunError{Stage: "wait", Err: p.err}
+	}
+	return p.cmd.ProcessState.ExitCode(), nil
+}
+
+func (l *LocalRunner) Stop(ctx context.Context, h *Handle) error {
+	l.mu.Lock()
+	p := l.procs[h.Tag]
+	l.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	select {
+	case <-p.done:
+		l.forget(h.Tag, p)
+		return nil
+	default:
+	}
+	if err := killProcessGroup(p.cmd); err != nil {
+		return &RunError{Stage: "stop", Err: err}
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	l.forget(h.Tag, p)
+	return nil
+}
+
+// forget убирает завершившийся процесс из procs, если под тегом ещё не
+// запущен новый.
+func (l *LocalRunner) forget(tag string, p *process) {
+	l.mu.Lock()
+	if l.procs[tag] == p {
+		delete(l.procs, tag)
+	}
+	l.mu.Unlock()
+}
+
+func (l *LocalRunner) Logs(ctx context.Context, name string, follow bool) (io.ReadCloser, error) {
+	tag := strings.TrimPrefix(name, l.NamePrefix+"-")
+	if tag == name || tag == "" || strings.ContainsAny(tag, `/\.`) {
+		return nil, fmt.Errorf("неизвестный прогон %q", name)
+	}
+
+	f, err := openRunLog(l.ResultsDir, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	p := l.procs[tag]
+	l.mu.Unlock()
+	if !follow || p == nil {
+		return f, nil
+	}
+	return &followReader{ctx: ctx, f: f, done: p.done}, nil
+}
+
+// followReader дочитывает растущий лог, пока процесс не завершится.
+type followReader struct {
+	ctx  context.Context
+	f    *os.File
+	done <-chan struct{}
+}
+
+func (r *followReader) Read(b []byte) (int, error) {
+	for {
+		n, err := r.f.Read(b)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		select {
+		case <-r.done:
+			return r.f.Read(b)
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	KindDocker = "docker"
+	KindLocal  = "local"
+)
+
+// Runner запускает bench/run.py и складывает результаты в ResultsDir/<tag>,
+// откуда их забирает ingest.Service.
+type Runner interface {
+	// Name возвращает имя, под которым будет виден прогон с данным тегом.
+	Name(tag string) string
+	Run(ctx context.Context, spec Spec) (*Handle, error)
+	// Wait блокируется до завершения прогона и возвращает код выхода run.py.
+	Wait(ctx context.Context, h *Handle) (int, error)
+	// Stop принудительно останавливает прогон и освобождает его ресурсы.
+	Stop(ctx context.Context, h *Handle) error
+	Logs(ctx context.Context, name string, follow bool) (io.ReadCloser, error)
+}
+
+// Spec описывает один прогон. Пустой Tag заменяется сгенерированным,
+// пустой Image — образом раннера по умолчанию.
+type Spec struct {
+	Tag    string
+	Args   []string
+	Limits Limits
+	Image  string
+	// FeasibilityTolerance передаётся run.py, чтобы он выбирал best_result
+	// по тому же допуску, что и бэкенд.
+	FeasibilityTolerance float64
+}
+
+// toleranceEnv — переменная окружения run.py с допуском нарушения ограничений.
+const toleranceEnv = "BOELA_FEASIBILITY_TOLERANCE"
+
+func (s Spec) toleranceEnv() string {
+	return toleranceEnv + "=" + strconv.FormatFloat(s.FeasibilityTolerance, 'g', -1, 64)
+}
+
+// Limits — ограничения ресурсов прогона; нулевые значения не ограничивают.
+// Ограничение по времени соблюдает вызывающий через контекст Wait.
+type Limits struct {
+	CPUs     float64
+	MemoryMB int
+}
+
+// ErrLost возвращается Wait, если раннер больше не знает о прогоне,
+// например после перезапуска бэкенда.
+var ErrLost = errors.New("прогон не найден")
+
+// ErrUnavailable оборачивают ошибки, после которых прогон стоит повторить:
+// раннер (например, Docker Engine) временно недоступен.
+var ErrUnavailable = errors.New("раннер недоступен")
+
+// Handle описывает запущенный прогон.
+type Handle struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	ResultsDir string `json:"results_dir"`
+}
+
+// Instance — прогон, найденный раннером при инвентаризации.
+type Instance struct {
+	Handle
+	Running    bool
+	ExitCode   int
+	FinishedAt time.Time
+}
+
+// Inventory реализуют раннеры, которые могут перечислить свои прогоны,
+// в том числе оставшиеся от предыдущего запуска бэкенда.
+type Inventory interface {
+	List(ctx context.Context) ([]Instance, error)
+}
+
+// RunError — ошибка запуска с указанием этапа, на котором она произошла.
+type RunError struct {
+	Stage string
+	Err   error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("ошибка запуска (%s): %v", e.Stage, e.Err)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+type Config struct {
+	Kind       string
+	ResultsDir string
+
+	DockerHost string
+	Image      string
+
+	Python   string
+	BenchDir string
+}
+
+var Default Runner
+
+// Init настраивает раннер, через который обработчики запускают прогоны.
+func Init(cfg Config) error {
+	r, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Default = r
+	return nil
+}
+
+func New(cfg Config) (Runner, error) {
+	switch cfg.Kind {
+	case "", KindDocker:
+		return NewDockerRunner(cfg.DockerHost, cfg.Image, cfg.ResultsDir)
+	case KindLocal:
+		return NewLocalRunner(cfg.Python, cfg.BenchDir, cfg.ResultsDir), nil
+	default:
+		return nil, fmt.Errorf("неизвестный тип раннера %q", cfg.Kind)
+	}
+}
+
+var lastTag int64
+
+// NewTag повторяет формат `date +%s%N`, которым раньше именовались папки результатов.
+// Теги строго возрастают, поэтому не совпадают и при пакетной постановке заданий.
+func NewTag() string {
+	for {
+		prev := atomic.LoadInt64(&lastTag)
+		next := time.Now().UnixNano()
+		if next <= prev {
+			next = prev + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastTag, prev, next) {
+			return strconv.FormatInt(next, 10)
+		}
+	}
+}
+
+// LogTail возвращает последние n строк лога прогона.
+func LogTail(ctx context.Context, r Runner, name string, n int) string {
+	logs, err := r.Logs(ctx, name, false)
+	if err != nil {
+		return fmt.Sprintf("не удалось получить лог: %v", err)
+	}
+	defer logs.Close()
+
+	lines := make([]string, 0, n)
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// logDirs — папки, в которых может лежать лог прогона: до загрузки
+// результатов, после неё и после отмены.
+func logDirs(tag string) []string {
+	return []string{tag, tag + ".processed", tag + ".cancelled"}
+}
+
+// openRunLog открывает сохранённый лог прогона с тегом tag.
+func openRunLog(resultsDir, tag string) (*os.File, error) {
+	for _, dir := range logDirs(tag) {
+		f, err := os.Open(filepath.Join(resultsDir, dir, LogFileName))
+		if err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("лог прогона %q не найден", tag)
+}
+
+// SaveLog сохраняет лог прогона в его папку результатов, если раннер не
+// пишет его сам. Папка ищется так же, как в openRunLog.
+func SaveLog(ctx context.Context, r Runner, resultsDir string, h *Handle) error {
+	var dir string
+	for _, d := range logDirs(h.Tag) {
+		if _, err := os.Stat(filepath.Join(resultsDir, d)); err == nil {
+			dir = filepath.Join(resultsDir, d)
+			break
+		}
+	}
+	if dir == "" {
+		return nil
+	}
+	path := filepath.Join(dir, LogFileName)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	logs, err := r.Logs(ctx, h.Name, false)
+	if err != nil {
+		return fmt.Errorf("ошибка получения лога %s: %v", h.Name, err)
+	}
+	defer logs.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, logs); err != nil {
+		return fmt.Errorf("ошибка сохранения лога %s: %v", h.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Package sampling строит планы экспериментов в единичном гиперкубе [0, 1)^d.
+package sampling
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	Random = "random"
+	LHS    = "lhs"
+	Sobol  = "sobol"
+)
+
+// Sample возвращает n точек размерности d, построенных методом method.
+// seed влияет на random и lhs; последовательность Соболя детерминирована.
+func Sample(method string, n, d int, seed int64) ([][]float64, error) {
+	if n <= 0 || d <= 0 {
+		return nil, fmt.Errorf("число точек и размерность должны быть положительными")
+	}
+	rng := rand.New(rand.NewSource(seed))
+	switch method {
+	case "", Random:
+		return uniform(n, d, rng), nil
+	case LHS:
+		return latinHypercube(n, d, rng), nil
+	case Sobol:
+		return sobol(n, d)
+	default:
+		return nil, fmt.Errorf("неизвестный метод выборки %q", method)
+	}
+}
+
+func uniform(n, d int, rng *rand.Rand) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, d)
+		for j := range points[i] {
+			points[i][j] = rng.Float64()
+		}
+	}
+	return points
+}
+
+// latinHypercube делит каждую ось на n равных интервалов и ставит в каждый
+// ровно одну точку; интервалы по разным осям перемешиваются независимо.
+func latinHypercube(n, d int, rng *rand.Rand) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, d)
+	}
+	for j := 0; j < d; j++ {
+		perm := rng.Perm(n)
+		for i := range points {
+			points[i][j] = (float64(perm[i]) + rng.Float64()) / float64(n)
+		}
+	}
+	return points
+}
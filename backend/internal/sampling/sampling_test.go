@@ -0,0 +1,107 @@
+package sampling
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSobolKnownPoints(t *testing.T) {
+	// Первые точки последовательности Соболя с направляющими числами Джо и
+	// Куо без нулевой точки, как в scipy.stats.qmc.Sobol(scramble=False).
+	want := [][]float64{
+		{0.5, 0.5, 0.5},
+		{0.75, 0.25, 0.25},
+		{0.25, 0.75, 0.75},
+		{0.375, 0.375, 0.625},
+		{0.875, 0.875, 0.125},
+		{0.625, 0.125, 0.875},
+		{0.125, 0.625, 0.375},
+	}
+	got, err := Sample(Sobol, len(want), 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if got[i][j] != want[i][j] {
+				t.Errorf("точка %d, измерение %d: %v, want %v", i+1, j+1, got[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+func TestSobolStratification(t *testing.T) {
+	// Вместе с нулевой точкой первые 2^k точек каждого измерения попадают
+	// по одной в каждый интервал [i/2^k, (i+1)/2^k).
+	const k = 10
+	n := 1<<k - 1
+	points, err := Sample(Sobol, n, MaxSobolDimensions, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < MaxSobolDimensions; j++ {
+		seen := make([]bool, 1<<k)
+		seen[0] = true
+		for _, p := range points {
+			cell := int(p[j] * (1 << k))
+			if seen[cell] {
+				t.Fatalf("измерение %d: два значения в интервале %d", j+1, cell)
+			}
+			seen[cell] = true
+		}
+	}
+}
+
+func TestSobolTooManyDimensions(t *testing.T) {
+	if _, err := Sample(Sobol, 1, MaxSobolDimensions+1, 0); err == nil {
+		t.Fatal("ожидалась ошибка для слишком большой размерности")
+	}
+}
+
+func TestLatinHypercube(t *testing.T) {
+	const n, d = 50, 4
+	points, err := Sample(LHS, n, d, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < d; j++ {
+		seen := make([]bool, n)
+		for _, p := range points {
+			cell := int(p[j] * n)
+			if seen[cell] {
+				t.Fatalf("измерение %d: два значения в интервале %d", j+1, cell)
+			}
+			seen[cell] = true
+		}
+	}
+	again, _ := Sample(LHS, n, d, 42)
+	for i := range points {
+		for j := range points[i] {
+			if points[i][j] != again[i][j] {
+				t.Fatal("одинаковый seed должен давать одинаковую выборку")
+			}
+		}
+	}
+}
+
+func TestSampleRange(t *testing.T) {
+	for _, method := range []string{Random, LHS, Sobol} {
+		points, err := Sample(method, 100, 3, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range points {
+			for _, v := range p {
+				if v < 0 || v >= 1 || math.IsNaN(v) {
+					t.Fatalf("%s: значение %v вне [0, 1)", method, v)
+				}
+			}
+		}
+	}
+	if _, err := Sample("grid", 1, 1, 0); err == nil {
+		t.Error("ожидалась ошибка для неизвестного метода")
+	}
+	if _, err := Sample(Random, 0, 1, 0); err == nil {
+		t.Error("ожидалась ошибка для n = 0")
+	}
+}
@@ -0,0 +1,79 @@
+package sampling
+
+import "fmt"
+
+const sobolBits = 32
+
+// sobolParams — направляющие числа Джо и Куо (new-joe-kuo-6.21201) для
+// измерений 2..21: степень примитивного многочлена s, его коэффициенты a
+// и начальные значения m. Первое измерение — последовательность ван дер Корпута.
+var sobolParams = []struct {
+	s int
+	a uint32
+	m []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+	{6, 19, []uint32{1, 1, 1, 15, 7, 5}},
+	{6, 22, []uint32{1, 3, 1, 15, 13, 25}},
+	{6, 25, []uint32{1, 1, 5, 5, 19, 61}},
+	{7, 1, []uint32{1, 3, 7, 11, 23, 15, 103}},
+	{7, 4, []uint32{1, 3, 7, 13, 13, 15, 69}},
+}
+
+// MaxSobolDimensions — наибольшая размерность, для которой есть направляющие числа.
+var MaxSobolDimensions = len(sobolParams) + 1
+
+// sobol строит первые n точек последовательности Соболя, пропуская нулевую,
+// методом кода Грея (Antonov–Saleev).
+func sobol(n, d int) ([][]float64, error) {
+	if d > MaxSobolDimensions {
+		return nil, fmt.Errorf("выборка Соболя поддерживает не больше %d параметров", MaxSobolDimensions)
+	}
+	dirs := make([][sobolBits]uint32, d)
+	for i := 0; i < sobolBits; i++ {
+		dirs[0][i] = 1 << (sobolBits - 1 - i)
+	}
+	for j := 1; j < d; j++ {
+		p := sobolParams[j-1]
+		v := &dirs[j]
+		for i := 0; i < p.s; i++ {
+			v[i] = p.m[i] << (sobolBits - 1 - i)
+		}
+		for i := p.s; i < sobolBits; i++ {
+			v[i] = v[i-p.s] ^ (v[i-p.s] >> p.s)
+			for k := 1; k < p.s; k++ {
+				v[i] ^= ((p.a >> (p.s - 1 - k)) & 1) * v[i-k]
+			}
+		}
+	}
+
+	points := make([][]float64, n)
+	x := make([]uint32, d)
+	for i := 0; i < n; i++ {
+		// Номер младшего нулевого бита i.
+		c := 0
+		for b := uint32(i); b&1 == 1; b >>= 1 {
+			c++
+		}
+		points[i] = make([]float64, d)
+		for j := 0; j < d; j++ {
+			x[j] ^= dirs[j][c]
+			points[i][j] = float64(x[j]) / (1 << sobolBits)
+		}
+	}
+	return points, nil
+}
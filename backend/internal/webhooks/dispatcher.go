@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+// Заголовки запроса вебхука. SignatureHeader содержит "sha256=" и
+// HMAC-SHA256 тела в hex, посчитанный на секрете вебхука.
+const (
+	SignatureHeader = "X-Boela-Signature"
+	EventHeader     = "X-Boela-Event"
+	DeliveryHeader  = "X-Boela-Delivery"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultInterval    = 5 * time.Second
+
+	requestTimeout = 10 * time.Second
+	claimBatch     = 20
+)
+
+// Dispatcher доставляет события из webhook_deliveries. Неудачные попытки
+// повторяются с задержкой по Backoff, после MaxAttempts доставка считается
+// проваленной.
+type Dispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     db.RetryPolicy
+	Interval    time.Duration
+	// Record сохраняет итог попытки; retryIn 0 у неудачной попытки означает
+	// окончательный провал. По умолчанию db.RecordWebhookAttempt.
+	Record func(id int64, delivered bool, responseStatus int, errMsg string, retryIn time.Duration) error
+}
+
+func NewDispatcher(maxAttempts int) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &Dispatcher{
+		Client:      &http.Client{Timeout: requestTimeout},
+		MaxAttempts: maxAttempts,
+		Backoff:     db.RetryPolicy{BackoffSeconds: 10, MaxBackoffSeconds: 3600},
+		Interval:    DefaultInterval,
+		Record:      db.RecordWebhookAttempt,
+	}
+}
+
+// Start проверяет очередь доставок каждые Interval, пока не отменён ctx.
+func (d *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			d.dispatch(ctx)
+		}
+	}()
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		// Доставки выдаются на время, за которое успевает завершиться запрос.
+		list, err := db.ClaimWebhookDeliveries(claimBatch, 2*requestTimeout)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for i := range list {
+			wg.Add(1)
+			go func(del *db.WebhookDelivery) {
+				defer wg.Done()
+				d.deliver(ctx, del)
+			}(&list[i])
+		}
+		wg.Wait()
+		if len(list) < claimBatch {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del *db.WebhookDelivery) {
+	status, err := d.send(ctx, del)
+	if err == nil {
+		if err := d.Record(del.ID, true, status, "", 0); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// Доставку выдадут снова после истечения аренды.
+		return
+	}
+	attempt := del.Attempts + 1
+	var retryIn time.Duration
+	if attempt < d.MaxAttempts {
+		retryIn = d.Backoff.Backoff(attempt)
+	} else {
+		log.Printf("Вебхук %d: доставка %d не удалась после %d попыток: %v", del.WebhookID, del.ID, attempt, err)
+	}
+	if err := d.Record(del.ID, false, status, err.Error(), retryIn); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// send отправляет доставку и возвращает HTTP-статус ответа. Успехом считается любой 2xx.
+func (d *Dispatcher) send(ctx context.Context, del *db.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, del.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(del.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(del.Secret, del.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("получатель ответил %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign возвращает значение SignatureHeader для тела body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
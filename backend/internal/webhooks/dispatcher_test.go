@@ -0,0 +1,155 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/axywe/distributed-benchmarks/internal/db"
+)
+
+type recordedAttempt struct {
+	delivered bool
+	status    int
+	retryIn   time.Duration
+}
+
+// deliverUntilDone повторяет доставку так, как её повторял бы dispatch с
+// базой: до успеха или окончательного провала (retryIn 0).
+func deliverUntilDone(t *testing.T, d *Dispatcher, del *db.WebhookDelivery) []recordedAttempt {
+	t.Helper()
+	var attempts []recordedAttempt
+	d.Record = func(id int64, delivered bool, status int, errMsg string, retryIn time.Duration) error {
+		if id != del.ID {
+			t.Errorf("recorded delivery %d, want %d", id, del.ID)
+		}
+		attempts = append(attempts, recordedAttempt{delivered, status, retryIn})
+		return nil
+	}
+	for i := 0; i < 2*d.MaxAttempts; i++ {
+		d.deliver(context.Background(), del)
+		if len(attempts) != i+1 {
+			t.Fatalf("deliver recorded %d attempts, want %d", len(attempts), i+1)
+		}
+		last := attempts[i]
+		if last.delivered || last.retryIn == 0 {
+			return attempts
+		}
+		del.Attempts++
+	}
+	t.Fatalf("delivery not finished after %d attempts", len(attempts))
+	return nil
+}
+
+func newTestDispatcher(maxAttempts int) *Dispatcher {
+	d := NewDispatcher(maxAttempts)
+	d.Backoff = db.RetryPolicy{BackoffSeconds: 1, MaxBackoffSeconds: 4}
+	return d
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	payload := []byte(`{"event":"job.succeeded","job_id":7}`)
+	secret := "s3cret"
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	wantSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != string(payload) {
+			t.Errorf("body = %s, want %s", body, payload)
+		}
+		if got := r.Header.Get(SignatureHeader); got != wantSignature {
+			t.Errorf("%s = %q, want %q", SignatureHeader, got, wantSignature)
+		}
+		if got := r.Header.Get(EventHeader); got != "job.succeeded" {
+			t.Errorf("%s = %q, want job.succeeded", EventHeader, got)
+		}
+		if got := r.Header.Get(DeliveryHeader); got != "42" {
+			t.Errorf("%s = %q, want 42", DeliveryHeader, got)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	del := &db.WebhookDelivery{ID: 42, Event: "job.succeeded", Payload: payload, URL: srv.URL, Secret: secret}
+	attempts := deliverUntilDone(t, newTestDispatcher(3), del)
+	if len(attempts) != 1 || !attempts[0].delivered || attempts[0].status != http.StatusNoContent {
+		t.Errorf("attempts = %+v, want one delivered with status 204", attempts)
+	}
+}
+
+func TestDeliverRetriesServerErrors(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(5)
+	del := &db.WebhookDelivery{ID: 1, Event: "job.failed", Payload: []byte(`{}`), URL: srv.URL}
+	attempts := deliverUntilDone(t, d, del)
+	if len(attempts) != 3 {
+		t.Fatalf("attempts = %+v, want 3", attempts)
+	}
+	for i, a := range attempts[:2] {
+		if a.delivered || a.status != http.StatusServiceUnavailable {
+			t.Errorf("attempt %d = %+v, want failed with status 503", i+1, a)
+		}
+		if want := d.Backoff.Backoff(i + 1); a.retryIn != want {
+			t.Errorf("attempt %d retryIn = %v, want %v", i+1, a.retryIn, want)
+		}
+	}
+	if last := attempts[2]; !last.delivered || last.status != http.StatusOK {
+		t.Errorf("last attempt = %+v, want delivered with status 200", last)
+	}
+}
+
+func TestDeliverFailsAfterMaxAttempts(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	del := &db.WebhookDelivery{ID: 1, Event: "batch.finished", Payload: []byte(`{}`), URL: srv.URL}
+	attempts := deliverUntilDone(t, newTestDispatcher(3), del)
+	if n := atomic.LoadInt32(&hits); len(attempts) != 3 || n != 3 {
+		t.Fatalf("attempts = %+v, requests = %d, want 3 of each", attempts, n)
+	}
+	for i, a := range attempts {
+		if a.delivered || a.status != http.StatusInternalServerError {
+			t.Errorf("attempt %d = %+v, want failed with status 500", i+1, a)
+		}
+	}
+	if attempts[1].retryIn == 0 {
+		t.Error("attempt before MaxAttempts marked failed")
+	}
+	if attempts[2].retryIn != 0 {
+		t.Errorf("last attempt retryIn = %v, want 0 (failed)", attempts[2].retryIn)
+	}
+}
+
+func TestDeliverUnreachableReceiver(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	del := &db.WebhookDelivery{ID: 1, Event: "job.failed", Payload: []byte(`{}`), URL: url}
+	attempts := deliverUntilDone(t, newTestDispatcher(2), del)
+	if len(attempts) != 2 || attempts[0].status != 0 || attempts[1].retryIn != 0 {
+		t.Errorf("attempts = %+v, want two failures without a response status", attempts)
+	}
+}
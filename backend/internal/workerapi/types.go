@@ -0,0 +1,58 @@
+package workerapi
+
+// Типы запросов и ответов между бэкендом и удалёнными воркерами (cmd/worker).
+
+// TokenHeader содержит общий секрет WORKER_TOKEN.
+const TokenHeader = "X-Worker-Token"
+
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+	Runner   string `json:"runner"`
+}
+
+type RegisterResponse struct {
+	WorkerID                 int `json:"worker_id"`
+	HeartbeatIntervalSeconds int `json:"heartbeat_interval_seconds"`
+}
+
+type HeartbeatRequest struct {
+	Running []int `json:"running"`
+}
+
+// HeartbeatResponse перечисляет задания, которые воркер должен остановить:
+// их отменили или они больше не числятся за ним.
+type HeartbeatResponse struct {
+	Cancel []int `json:"cancel"`
+}
+
+type Lease struct {
+	JobID          int      `json:"job_id"`
+	Tag            string   `json:"tag"`
+	Args           []string `json:"args"`
+	CPUs           float64  `json:"cpus,omitempty"`
+	MemoryMB       int      `json:"memory_mb,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+	// Image — образ метода; пуст, пока бэкенд не выдаёт воркерам задания
+	// методов с собственным образом.
+	Image string `json:"image,omitempty"`
+	// FeasibilityTolerance — допуск бэкенда для выбора best_result в run.py.
+	FeasibilityTolerance float64 `json:"feasibility_tolerance,omitempty"`
+}
+
+type StartedRequest struct {
+	ContainerID string `json:"container_id"`
+}
+
+type CompleteRequest struct {
+	// ExitCode равен nil, если run.py не дошёл до завершения.
+	ExitCode *int   `json:"exit_code,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Transient — ошибка раннера воркера временная (runner.ErrUnavailable).
+	Transient bool   `json:"transient,omitempty"`
+	LogTail   string `json:"log_tail,omitempty"`
+}
+
+// ResultFiles — файлы прогона, которые воркер загружает на бэкенд.
+var ResultFiles = []string{"results.json", "results.csv", "run.log"}
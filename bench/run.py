@@ -1,7 +1,10 @@
 import argparse
+import hashlib
 import importlib
+import importlib.util
 import json
 import logging
+import os
 import pandas as pd  # type: ignore
 import sys
 from typing import Dict, Any
@@ -10,6 +13,29 @@ import boela.optimizer  # type: ignore
 import boela.problems  # type: ignore
 import boela.problems.bbob  # type: ignore
 
+# В контейнере результаты пишутся в смонтированный /results,
+# локальный раннер передаёт папку прогона через окружение.
+RESULTS_DIR = os.environ.get("BOELA_RESULTS_DIR", "/results")
+# Дайджест образа передаёт Docker-раннер; при локальном запуске он пуст.
+IMAGE_DIGEST = os.environ.get("BOELA_IMAGE_DIGEST", "")
+# Допуск нарушения ограничений передаёт раннер: тот же FEASIBILITY_TOLERANCE, что у бэкенда.
+FEASIBILITY_TOLERANCE = float(os.environ.get("BOELA_FEASIBILITY_TOLERANCE") or 0)
+
+# Версия run.py записывается в каждый результат. Повышать при изменениях,
+# влияющих на то, как считаются или сохраняются результаты.
+RUN_VERSION = "1.4"
+
+
+def apply_memory_limit():
+    """Ограничивает адресное пространство при запуске без Docker"""
+    limit_mb = os.environ.get("BOELA_MEMORY_LIMIT_MB")
+    if not limit_mb:
+        return
+    import resource
+    limit = int(limit_mb) * 1024 * 1024
+    resource.setrlimit(resource.RLIMIT_AS, (limit, limit))
+    logging.info(f"Лимит памяти: {limit_mb} МБ")
+
 
 def parse_known_args() -> (argparse.Namespace, Dict[str, Any]): # type: ignore
     parser = argparse.ArgumentParser(description="Run optimization using Boela")
@@ -65,6 +91,35 @@ def load_algorithm(full_path: str):
         return None
 
 
+def source_hash(full_path: str) -> str:
+    """Считает sha256 исходников метода: файла модуля или всей папки пакета"""
+    try:
+        spec = importlib.util.find_spec(full_path)
+    except Exception:
+        return ""
+    if spec is None or not spec.origin or not os.path.isfile(spec.origin):
+        return ""
+    if spec.submodule_search_locations:
+        root = os.path.dirname(spec.origin)
+        files = []
+        for dirpath, dirnames, filenames in os.walk(root):
+            dirnames[:] = sorted(d for d in dirnames if d != "__pycache__")
+            files.extend(os.path.join(dirpath, name) for name in filenames
+                         if not name.endswith(".pyc"))
+    else:
+        root = os.path.dirname(spec.origin)
+        files = [spec.origin]
+
+    h = hashlib.sha256()
+    for path in sorted(files):
+        with open(path, "rb") as f:
+            data = f.read()
+        rel = os.path.relpath(path, root).replace(os.sep, "/")
+        h.update(f"\0{rel}\0{len(data)}\0".encode())
+        h.update(data)
+    return "sha256:" + h.hexdigest()
+
+
 def main():
     logging.basicConfig(
         level=logging.INFO,
@@ -74,6 +129,7 @@ def main():
     )
 
     logging.info("Запуск скрипта оптимизации.")
+    apply_memory_limit()
     args, dynamic_args = parse_known_args()
     user_id = args.user_id
     logging.info(f"Фиксированные аргументы: {args}")
@@ -113,8 +169,20 @@ def main():
         data=problem.history,
         columns=problem.variable_names + problem.objective_names + problem.constraint_names,
     )
-    obj_col = "f[1]" if "f[1]" in history.columns else history.columns[-1]
-    best_index = history[obj_col].idxmin()
+    objectives = [c for c in problem.objective_names if c in history.columns] or [history.columns[-1]]
+    constraints = [c for c in problem.constraint_names if c in history.columns]
+    # При нескольких целях лучшей считается лексикографически минимальная точка:
+    # она всегда лежит на фронте Парето, который бэкенд строит по results.csv.
+    # Ограничения записываются как g <= 0 с допуском бэкенда: сначала идут
+    # допустимые точки, затем недопустимые по возрастанию суммарного нарушения.
+    ranked = history
+    order = objectives
+    if constraints:
+        feasible = (history[constraints] <= FEASIBILITY_TOLERANCE).all(axis=1)
+        violation = history[constraints].clip(lower=0).sum(axis=1, skipna=False)
+        ranked = history.assign(_infeasible=~feasible, _violation=violation.where(~feasible, 0.0))
+        order = ["_infeasible", "_violation"] + objectives
+    best_index = ranked.sort_values(order, kind="stable").index[0]
     best_result = history.loc[best_index].to_dict()
 
     expected_budget = algorithm.expected_budget(problem)
@@ -128,14 +196,21 @@ def main():
         "expected_budget": expected_budget,
         "actual_budget": actual_budget,
         "best_result": best_result,
+        "image_digest": IMAGE_DIGEST,
+        "source_hash": source_hash(args.method),
+        "run_version": RUN_VERSION,
     }
 
-    with open("/results/results.json", "w") as f:
+    history.to_csv(os.path.join(RESULTS_DIR, "results.csv"), index=False)
+    # results.json появляется последним и атомарно: бэкенд загружает папку,
+    # как только видит этот файл.
+    path = os.path.join(RESULTS_DIR, "results.json")
+    with open(path + ".tmp", "w") as f:
         json.dump(results, f, indent=4)
-    history.to_csv("/results/results.csv", index=False)
+    os.replace(path + ".tmp", path)
 
     logging.info("Результаты сохранены.")
 
 
 if __name__ == "__main__":
-    main()
+    sys.exit(main())
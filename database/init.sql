@@ -1,3 +1,17 @@
+DROP TABLE IF EXISTS ingest_failures;
+DROP TABLE IF EXISTS cache_hits;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS job_attempts;
+DROP TABLE IF EXISTS job_events;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS batches;
+DROP TABLE IF EXISTS experiment_results;
+DROP TABLE IF EXISTS experiments;
+DROP TABLE IF EXISTS workers;
+DROP TABLE IF EXISTS quotas;
+DROP TABLE IF EXISTS pareto_points;
+DROP TABLE IF EXISTS optimization_history;
 DROP TABLE IF EXISTS optimization_input_parameters;
 DROP TABLE IF EXISTS optimization_results;
 DROP TABLE IF EXISTS optimization_methods;
@@ -7,14 +21,22 @@ CREATE TABLE optimization_methods (
     id SERIAL PRIMARY KEY,
     name TEXT NOT NULL UNIQUE,
     parameters JSONB NOT NULL,
-    file_path TEXT NOT NULL DEFAULT ''
+    file_path TEXT NOT NULL DEFAULT '',
+    -- переопределения лимитов прогона: {"cpus": 2, "memory_mb": 4096, "timeout_seconds": 3600}
+    limits JSONB NOT NULL DEFAULT '{}',
+    -- повторы временных сбоев: {"max_attempts": 3, "backoff_seconds": 10, "max_backoff_seconds": 600}
+    retry_policy JSONB NOT NULL DEFAULT '{}',
+    -- образ, собранный через POST /api/v1/methods/{id}/build; пустой — BENCH_IMAGE
+    image TEXT NOT NULL DEFAULT ''
 );
 
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
     login TEXT UNIQUE NOT NULL,
     password TEXT NOT NULL,
-    "group" TEXT
+    "group" TEXT,
+    -- вес пользователя при справедливом разделении слотов между очередями
+    weight REAL NOT NULL DEFAULT 1 CHECK (weight > 0)
 );
 
 CREATE TABLE optimization_results (
@@ -32,7 +54,21 @@ CREATE TABLE optimization_results (
     expected_budget INTEGER NOT NULL,
     actual_budget INTEGER NOT NULL,
     best_result_x DOUBLE PRECISION[] NOT NULL,
-    best_result_f DOUBLE PRECISION NOT NULL
+    best_result_f DOUBLE PRECISION NOT NULL,
+    -- все цели лучшей точки: f[1], f[2], ...; best_result_f равен первой из них
+    best_result_objectives DOUBLE PRECISION[] NOT NULL DEFAULT '{}',
+    -- ограничения лучшей точки (g <= 0), их суммарное нарушение max(0, g) и
+    -- допустимость с учётом FEASIBILITY_TOLERANCE; при смене допуска сервер
+    -- пересчитывает их и фронт Парето при старте
+    constraint_names TEXT[] NOT NULL DEFAULT '{}',
+    constraint_values DOUBLE PRECISION[] NOT NULL DEFAULT '{}',
+    constraint_violation DOUBLE PRECISION NOT NULL DEFAULT 0,
+    feasible BOOLEAN NOT NULL DEFAULT TRUE,
+    feasibility_tolerance DOUBLE PRECISION NOT NULL DEFAULT 0,
+    -- происхождение результата: образ контейнера, хэш исходников метода и версия run.py
+    image_digest TEXT NOT NULL DEFAULT '',
+    source_hash TEXT NOT NULL DEFAULT '',
+    run_version TEXT NOT NULL DEFAULT ''
 );
 
 CREATE TABLE optimization_input_parameters (
@@ -48,6 +84,208 @@ CREATE TABLE optimization_input_parameters (
 CREATE INDEX idx_input_param_result ON optimization_input_parameters(result_id);
 CREATE INDEX idx_input_param_name_num ON optimization_input_parameters(name, value_numeric);
 
+-- история вычислений из results.csv; x, f и g — столбцы подряд, каждый из
+-- evaluations значений float64 little-endian в порядке x_names, f_names и g_names
+CREATE TABLE optimization_history (
+    result_id TEXT PRIMARY KEY REFERENCES optimization_results(result_id) ON DELETE CASCADE,
+    evaluations INTEGER NOT NULL,
+    x_names TEXT[] NOT NULL,
+    f_names TEXT[] NOT NULL,
+    g_names TEXT[] NOT NULL,
+    x BYTEA NOT NULL,
+    f BYTEA NOT NULL,
+    g BYTEA NOT NULL
+);
+
+-- недоминируемые вычисления из истории; evaluation — номер вычисления с 1
+CREATE TABLE pareto_points (
+    result_id TEXT NOT NULL REFERENCES optimization_results(result_id) ON DELETE CASCADE,
+    evaluation INTEGER NOT NULL,
+    x DOUBLE PRECISION[] NOT NULL,
+    f DOUBLE PRECISION[] NOT NULL,
+    PRIMARY KEY (result_id, evaluation)
+);
+
+-- квота задаётся либо пользователю, либо группе ('anonymous' — запуски без
+-- авторизации); 0 снимает ограничение, ненулевые поля пользователя важнее группы
+CREATE TABLE quotas (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    "group" TEXT UNIQUE,
+    max_concurrent INTEGER NOT NULL DEFAULT 0,
+    max_runs_per_day INTEGER NOT NULL DEFAULT 0,
+    max_budget_per_day BIGINT NOT NULL DEFAULT 0,
+    CHECK ((user_id IS NULL) <> ("group" IS NULL))
+);
+
+CREATE TABLE workers (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    capacity INTEGER NOT NULL DEFAULT 1,
+    runner TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'online',
+    registered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_heartbeat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE experiments (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    archived BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT uq_experiment_name UNIQUE (user_id, name)
+);
+
+CREATE TABLE experiment_results (
+    experiment_id INTEGER NOT NULL REFERENCES experiments(id) ON DELETE CASCADE,
+    result_id TEXT NOT NULL REFERENCES optimization_results(result_id) ON DELETE CASCADE,
+    PRIMARY KEY (experiment_id, result_id)
+);
+
+CREATE INDEX idx_experiment_results_result ON experiment_results(result_id);
+
+-- kind: 'grid' — декартово произведение значений параметров, 'sweep' — выборка гиперпараметров
+CREATE TABLE batches (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    experiment_id INTEGER REFERENCES experiments(id) ON DELETE SET NULL,
+    kind TEXT NOT NULL DEFAULT 'grid',
+    spec JSONB NOT NULL,
+    total INTEGER NOT NULL,
+    cached INTEGER NOT NULL DEFAULT 0,
+    invalid INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- момент, когда все задания пакета пришли в конечное состояние
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_batches_user ON batches(user_id, id);
+
+-- worker_id IS NULL: задание выполняется пулом самого бэкенда
+CREATE TABLE jobs (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    method_id INTEGER NOT NULL REFERENCES optimization_methods(id) ON DELETE CASCADE,
+    parameters JSONB NOT NULL,
+    args TEXT[] NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    tag TEXT NOT NULL UNIQUE,
+    container_id TEXT NOT NULL DEFAULT '',
+    container_name TEXT NOT NULL DEFAULT '',
+    exit_code INTEGER,
+    error_tail TEXT NOT NULL DEFAULT '',
+    result_id TEXT,
+    worker_id INTEGER REFERENCES workers(id) ON DELETE SET NULL,
+    batch_id INTEGER REFERENCES batches(id) ON DELETE CASCADE,
+    experiment_id INTEGER REFERENCES experiments(id) ON DELETE SET NULL,
+    -- result_id результата, который повторяет задание
+    rerun_of TEXT REFERENCES optimization_results(result_id) ON DELETE SET NULL,
+    -- задания с большим приоритетом выдаются раньше: одиночные запуски 10, пакеты 0
+    priority INTEGER NOT NULL DEFAULT 0,
+    -- ожидаемый бюджет прогона из запроса или оценка по прошлым результатам метода;
+    -- учитывается квотой, пока результат не загружен
+    budget BIGINT,
+    attempt INTEGER NOT NULL DEFAULT 1,
+    -- повторная попытка не выдаётся раньше not_before
+    not_before TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_jobs_status ON jobs(status, id);
+CREATE INDEX idx_jobs_user ON jobs(user_id, id);
+CREATE INDEX idx_jobs_batch ON jobs(batch_id);
+CREATE INDEX idx_jobs_experiment ON jobs(experiment_id);
+CREATE INDEX idx_jobs_rerun ON jobs(rerun_of);
+
+-- status: состояние, в которое перешло задание, либо 'ingested' после загрузки результата
+CREATE TABLE job_events (
+    id BIGSERIAL PRIMARY KEY,
+    job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    -- транзакция, записавшая событие; поток событий идёт в порядке фиксации транзакций
+    xid BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_job_events_job ON job_events(job_id, id);
+CREATE INDEX idx_job_events_xid ON job_events(xid, id);
+
+-- запуски, закрытые готовыми результатами; id берётся из счётчика job_events,
+-- чтобы оба вида событий шли в GET /api/v1/events одной последовательностью
+CREATE TABLE cache_hits (
+    id BIGINT PRIMARY KEY DEFAULT nextval('job_events_id_seq'),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    batch_id INTEGER REFERENCES batches(id) ON DELETE CASCADE,
+    experiment_id INTEGER REFERENCES experiments(id) ON DELETE SET NULL,
+    result_ids TEXT[] NOT NULL,
+    xid BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_cache_hits_user ON cache_hits(user_id, id);
+CREATE INDEX idx_cache_hits_xid ON cache_hits(xid, id);
+
+-- папки результатов в карантине (<result_id>.failed) и последняя ошибка их загрузки
+CREATE TABLE ingest_failures (
+    result_id TEXT PRIMARY KEY,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    first_failed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE job_attempts (
+    id SERIAL PRIMARY KEY,
+    job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    exit_code INTEGER,
+    error_tail TEXT NOT NULL DEFAULT '',
+    worker_id INTEGER REFERENCES workers(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT uq_job_attempt UNIQUE (job_id, attempt)
+);
+
+-- events: подписка на job.succeeded, job.failed, batch.finished, ingestion.failed
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    -- ключ HMAC-SHA256 подписи тела запроса
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_webhooks_user ON webhooks(user_id);
+
+-- status: pending, delivered или failed после исчерпания попыток
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ DEFAULT now(),
+    response_status INTEGER,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
 INSERT INTO optimization_methods (name, parameters) VALUES (
   'algorithms.pso',
   '{
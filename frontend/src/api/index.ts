@@ -19,6 +19,7 @@ export interface SubmitOptimizationResponse {
   data: {
     cached: boolean;
     matches?: OptimizationResult[];
+    job_id?: number;
     container_name?: string;
   };
   meta?: any;